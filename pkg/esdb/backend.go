@@ -0,0 +1,113 @@
+package esdb
+
+import (
+	"context"
+
+	"github.com/EventStore/EventStore-Client-Go/v4/esdb"
+)
+
+// subscriberClient is the part of *esdb.Client used by Subscriber.
+// The client returns concrete types, so it's adapted by esdbClient, which lets tests run subscribers against an in-memory backend.
+type subscriberClient interface {
+	streamReader
+	SubscribeToStream(ctx context.Context, streamID string, opts esdb.SubscribeToStreamOptions) (catchUpSubscription, error)
+	CreatePersistentSubscription(ctx context.Context, streamName string, groupName string, options esdb.PersistentStreamSubscriptionOptions) error
+	SubscribeToPersistentSubscription(ctx context.Context, streamName string, groupName string, options esdb.SubscribeToPersistentSubscriptionOptions) (persistentSubscription, error)
+	GetPersistentSubscriptionInfo(ctx context.Context, streamName string, groupName string, options esdb.GetPersistentSubscriptionOptions) (*esdb.PersistentSubscriptionInfo, error)
+	Close() error
+}
+
+type streamReader interface {
+	ReadStream(ctx context.Context, streamID string, opts esdb.ReadStreamOptions, count uint64) (readStream, error)
+}
+
+// publisherClient is the part of *esdb.Client used by Publisher.
+type publisherClient interface {
+	streamReader
+	AppendToStream(ctx context.Context, streamID string, opts esdb.AppendToStreamOptions, events ...esdb.EventData) (*esdb.WriteResult, error)
+	SetStreamMetadata(ctx context.Context, streamID string, opts esdb.AppendToStreamOptions, metadata esdb.StreamMetadata) (*esdb.WriteResult, error)
+	GetStreamMetadata(ctx context.Context, streamID string, opts esdb.ReadStreamOptions) (*esdb.StreamMetadata, error)
+	Close() error
+}
+
+// readerClient is the part of *esdb.Client used by Reader.
+type readerClient interface {
+	streamReader
+	ReadAll(ctx context.Context, opts esdb.ReadAllOptions, count uint64) (readStream, error)
+	Close() error
+}
+
+type catchUpSubscription interface {
+	Recv() *esdb.SubscriptionEvent
+	Close() error
+}
+
+type persistentSubscription interface {
+	Recv() *esdb.PersistentSubscriptionEvent
+	Ack(events ...*esdb.ResolvedEvent) error
+	Nack(reason string, action esdb.NackAction, events ...*esdb.ResolvedEvent) error
+	Close() error
+}
+
+type readStream interface {
+	Recv() (*esdb.ResolvedEvent, error)
+	Close()
+}
+
+type esdbClient struct {
+	*esdb.Client
+}
+
+func (c esdbClient) SubscribeToStream(
+	ctx context.Context,
+	streamID string,
+	opts esdb.SubscribeToStreamOptions,
+) (catchUpSubscription, error) {
+	subscription, err := c.Client.SubscribeToStream(ctx, streamID, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return subscription, nil
+}
+
+func (c esdbClient) SubscribeToPersistentSubscription(
+	ctx context.Context,
+	streamName string,
+	groupName string,
+	options esdb.SubscribeToPersistentSubscriptionOptions,
+) (persistentSubscription, error) {
+	subscription, err := c.Client.SubscribeToPersistentSubscription(ctx, streamName, groupName, options)
+	if err != nil {
+		return nil, err
+	}
+
+	return subscription, nil
+}
+
+func (c esdbClient) ReadStream(
+	ctx context.Context,
+	streamID string,
+	opts esdb.ReadStreamOptions,
+	count uint64,
+) (readStream, error) {
+	stream, err := c.Client.ReadStream(ctx, streamID, opts, count)
+	if err != nil {
+		return nil, err
+	}
+
+	return stream, nil
+}
+
+func (c esdbClient) ReadAll(
+	ctx context.Context,
+	opts esdb.ReadAllOptions,
+	count uint64,
+) (readStream, error) {
+	stream, err := c.Client.ReadAll(ctx, opts, count)
+	if err != nil {
+		return nil, err
+	}
+
+	return stream, nil
+}
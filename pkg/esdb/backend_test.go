@@ -0,0 +1,384 @@
+package esdb
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/EventStore/EventStore-Client-Go/v4/esdb"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/require"
+)
+
+var errSubscriptionClosed = errors.New("subscription has been dropped")
+
+// memoryBackend is an in-memory subscriberClient. Tests push events to its subscriptions.
+type memoryBackend struct {
+	lock       sync.Mutex
+	options    []esdb.SubscribeToStreamOptions
+	catchUp    []*memoryCatchUpSubscription
+	persistent []*memoryPersistentSubscription
+	streams    map[string][]*esdb.RecordedEvent
+	metadata   map[string]esdb.StreamMetadata
+	// metadataOptions are the options metadata was last set with.
+	metadataOptions esdb.AppendToStreamOptions
+	all             []*esdb.RecordedEvent
+	reads           int
+	// stats are the stats of persistent subscriptions.
+	stats *esdb.PersistentSubscriptionStats
+}
+
+func (b *memoryBackend) SubscribeToStream(ctx context.Context, _ string, options esdb.SubscribeToStreamOptions) (catchUpSubscription, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.options = append(b.options, options)
+	subscription := &memoryCatchUpSubscription{
+		ctx:    ctx,
+		events: make(chan *esdb.SubscriptionEvent, 16),
+		closed: make(chan struct{}),
+	}
+	b.catchUp = append(b.catchUp, subscription)
+	return subscription, nil
+}
+
+func (b *memoryBackend) CreatePersistentSubscription(context.Context, string, string, esdb.PersistentStreamSubscriptionOptions) error {
+	return nil
+}
+
+func (b *memoryBackend) SubscribeToPersistentSubscription(ctx context.Context, _ string, _ string, _ esdb.SubscribeToPersistentSubscriptionOptions) (persistentSubscription, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	subscription := &memoryPersistentSubscription{
+		ctx:    ctx,
+		events: make(chan *esdb.PersistentSubscriptionEvent, 16),
+		closed: make(chan struct{}),
+	}
+	b.persistent = append(b.persistent, subscription)
+	return subscription, nil
+}
+
+func (b *memoryBackend) GetPersistentSubscriptionInfo(context.Context, string, string, esdb.GetPersistentSubscriptionOptions) (*esdb.PersistentSubscriptionInfo, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return &esdb.PersistentSubscriptionInfo{Stats: b.stats}, nil
+}
+
+func (b *memoryBackend) ReadStream(_ context.Context, stream string, options esdb.ReadStreamOptions, count uint64) (readStream, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.reads++
+	var events []*esdb.RecordedEvent
+	if options.Direction == esdb.Backwards {
+		for i := len(b.streams[stream]) - 1; i >= 0; i-- {
+			event := b.streams[stream][i]
+			if revision, ok := options.From.(esdb.StreamRevision); ok && event.EventNumber > revision.Value {
+				continue
+			}
+			events = append(events, event)
+		}
+	} else {
+		for _, event := range b.streams[stream] {
+			if revision, ok := options.From.(esdb.StreamRevision); ok && event.EventNumber < revision.Value {
+				continue
+			}
+			events = append(events, event)
+		}
+	}
+
+	return newMemoryReadStream(events, count), nil
+}
+
+func (b *memoryBackend) ReadAll(_ context.Context, options esdb.ReadAllOptions, count uint64) (readStream, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.reads++
+	var events []*esdb.RecordedEvent
+	if options.Direction == esdb.Backwards {
+		for i := len(b.all) - 1; i >= 0; i-- {
+			event := b.all[i]
+			if position, ok := options.From.(esdb.Position); ok && event.Position.Commit > position.Commit {
+				continue
+			}
+			events = append(events, event)
+		}
+	} else {
+		for _, event := range b.all {
+			if position, ok := options.From.(esdb.Position); ok && event.Position.Commit < position.Commit {
+				continue
+			}
+			events = append(events, event)
+		}
+	}
+
+	return newMemoryReadStream(events, count), nil
+}
+
+func (b *memoryBackend) AppendToStream(_ context.Context, stream string, options esdb.AppendToStreamOptions, events ...esdb.EventData) (*esdb.WriteResult, error) {
+	b.lock.Lock()
+	current := len(b.streams[stream])
+	b.lock.Unlock()
+
+	switch expected := options.ExpectedRevision.(type) {
+	case esdb.NoStream:
+		if current > 0 {
+			return nil, ErrWrongExpectedVersion
+		}
+	case esdb.StreamExists:
+		if current == 0 {
+			return nil, ErrWrongExpectedVersion
+		}
+	case esdb.StreamRevision:
+		if uint64(current) != expected.Value+1 {
+			return nil, ErrWrongExpectedVersion
+		}
+	}
+
+	recorded := make([]*esdb.RecordedEvent, 0, len(events))
+	for i, event := range events {
+		recorded = append(recorded, &esdb.RecordedEvent{
+			EventID:      event.EventID,
+			EventType:    event.EventType,
+			ContentType:  ContentTypeJSON,
+			UserMetadata: event.Metadata,
+			Data:         event.Data,
+			EventNumber:  uint64(current + i),
+		})
+	}
+	b.appendToStream(stream, recorded...)
+
+	return &esdb.WriteResult{NextExpectedVersion: uint64(current + len(events) - 1)}, nil
+}
+
+func (b *memoryBackend) SetStreamMetadata(_ context.Context, stream string, options esdb.AppendToStreamOptions, metadata esdb.StreamMetadata) (*esdb.WriteResult, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.metadataOptions = options
+
+	if b.metadata == nil {
+		b.metadata = map[string]esdb.StreamMetadata{}
+	}
+	b.metadata[stream] = metadata
+	return &esdb.WriteResult{}, nil
+}
+
+func (b *memoryBackend) GetStreamMetadata(_ context.Context, stream string, _ esdb.ReadStreamOptions) (*esdb.StreamMetadata, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	metadata := b.metadata[stream]
+	return &metadata, nil
+}
+
+// appendToStream appends events to stream and $all, so they can be read.
+func (b *memoryBackend) appendToStream(stream string, events ...*esdb.RecordedEvent) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.streams == nil {
+		b.streams = map[string][]*esdb.RecordedEvent{}
+	}
+	for _, event := range events {
+		event.StreamID = stream
+		event.Position = esdb.Position{Commit: uint64(len(b.all)), Prepare: uint64(len(b.all))}
+		b.streams[stream] = append(b.streams[stream], event)
+		b.all = append(b.all, event)
+	}
+}
+
+func (b *memoryBackend) Close() error {
+	return nil
+}
+
+func (b *memoryBackend) catchUpSubscription(t *testing.T, i int) *memoryCatchUpSubscription {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	require.Greater(t, len(b.catchUp), i)
+	return b.catchUp[i]
+}
+
+// waitForCatchUpSubscriptions waits until there are n catch-up subscriptions, for example after resubscribing.
+func (b *memoryBackend) waitForCatchUpSubscriptions(t *testing.T, n int) {
+	t.Helper()
+
+	require.Eventually(t, func() bool {
+		b.lock.Lock()
+		defer b.lock.Unlock()
+
+		return len(b.catchUp) >= n
+	}, time.Second, time.Millisecond)
+}
+
+func (b *memoryBackend) subscribeOptions(i int) esdb.SubscribeToStreamOptions {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.options[i]
+}
+
+func (b *memoryBackend) persistentSubscription(t *testing.T, i int) *memoryPersistentSubscription {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	require.Greater(t, len(b.persistent), i)
+	return b.persistent[i]
+}
+
+type memoryReadStream struct {
+	events []*esdb.RecordedEvent
+}
+
+func newMemoryReadStream(events []*esdb.RecordedEvent, count uint64) *memoryReadStream {
+	if uint64(len(events)) > count {
+		events = events[:count]
+	}
+
+	return &memoryReadStream{events: events}
+}
+
+func (s *memoryReadStream) Recv() (*esdb.ResolvedEvent, error) {
+	if len(s.events) == 0 {
+		return nil, io.EOF
+	}
+
+	event := s.events[0]
+	s.events = s.events[1:]
+	return &esdb.ResolvedEvent{Event: event}, nil
+}
+
+func (s *memoryReadStream) Close() {}
+
+type memoryCatchUpSubscription struct {
+	ctx    context.Context
+	events chan *esdb.SubscriptionEvent
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (s *memoryCatchUpSubscription) Recv() *esdb.SubscriptionEvent {
+	select {
+	case event := <-s.events:
+		return event
+	case <-s.closed:
+	case <-s.ctx.Done():
+	}
+
+	return &esdb.SubscriptionEvent{SubscriptionDropped: &esdb.SubscriptionDropped{Error: errSubscriptionClosed}}
+}
+
+func (s *memoryCatchUpSubscription) Close() error {
+	s.once.Do(func() {
+		close(s.closed)
+	})
+	return nil
+}
+
+func (s *memoryCatchUpSubscription) append(event *esdb.ResolvedEvent) {
+	s.events <- &esdb.SubscriptionEvent{EventAppeared: event}
+}
+
+func (s *memoryCatchUpSubscription) caughtUp() {
+	s.events <- &esdb.SubscriptionEvent{CaughtUp: &esdb.Subscription{}}
+}
+
+func (s *memoryCatchUpSubscription) drop(err error) {
+	s.events <- &esdb.SubscriptionEvent{SubscriptionDropped: &esdb.SubscriptionDropped{Error: err}}
+}
+
+type memoryPersistentSubscription struct {
+	ctx    context.Context
+	events chan *esdb.PersistentSubscriptionEvent
+	closed chan struct{}
+	once   sync.Once
+
+	lock  sync.Mutex
+	acked []*esdb.ResolvedEvent
+	nacks map[esdb.NackAction][]*esdb.ResolvedEvent
+}
+
+func (s *memoryPersistentSubscription) Recv() *esdb.PersistentSubscriptionEvent {
+	select {
+	case event := <-s.events:
+		return event
+	case <-s.closed:
+	case <-s.ctx.Done():
+	}
+
+	return &esdb.PersistentSubscriptionEvent{SubscriptionDropped: &esdb.SubscriptionDropped{Error: errSubscriptionClosed}}
+}
+
+func (s *memoryPersistentSubscription) Ack(events ...*esdb.ResolvedEvent) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.acked = append(s.acked, events...)
+	return nil
+}
+
+func (s *memoryPersistentSubscription) Nack(_ string, action esdb.NackAction, events ...*esdb.ResolvedEvent) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.nacks == nil {
+		s.nacks = map[esdb.NackAction][]*esdb.ResolvedEvent{}
+	}
+	s.nacks[action] = append(s.nacks[action], events...)
+	return nil
+}
+
+func (s *memoryPersistentSubscription) Close() error {
+	s.once.Do(func() {
+		close(s.closed)
+	})
+	return nil
+}
+
+func (s *memoryPersistentSubscription) append(event *esdb.ResolvedEvent) {
+	s.events <- &esdb.PersistentSubscriptionEvent{EventAppeared: &esdb.EventAppeared{Event: event}}
+}
+
+func (s *memoryPersistentSubscription) ackedEvents() []*esdb.ResolvedEvent {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]*esdb.ResolvedEvent(nil), s.acked...)
+}
+
+func (s *memoryPersistentSubscription) nackedEvents(action esdb.NackAction) []*esdb.ResolvedEvent {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]*esdb.ResolvedEvent(nil), s.nacks[action]...)
+}
+
+// newTestEvent returns the event at revision which the default marshaler would store for a message with uuid.
+func newTestEvent(t *testing.T, uuid string, revision uint64) *esdb.ResolvedEvent {
+	t.Helper()
+
+	return &esdb.ResolvedEvent{Event: newTestRecordedEvent(t, uuid, revision)}
+}
+
+func newTestRecordedEvent(t *testing.T, uuid string, revision uint64) *esdb.RecordedEvent {
+	t.Helper()
+
+	eventData, err := DefaultMarshaler{}.Marshal(message.NewMessage(uuid, []byte(`{}`)))
+	require.NoError(t, err)
+
+	return &esdb.RecordedEvent{
+		EventID:      eventData.EventID,
+		EventType:    eventData.EventType,
+		ContentType:  ContentTypeJSON,
+		UserMetadata: eventData.Metadata,
+		Data:         eventData.Data,
+		EventNumber:  revision,
+	}
+}
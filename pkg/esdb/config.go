@@ -1,6 +1,8 @@
 package esdb
 
 import (
+	"time"
+
 	"github.com/EventStore/EventStore-Client-Go/v4/esdb"
 	"github.com/google/uuid"
 )
@@ -14,6 +16,24 @@ type SubscriberConfig struct {
 	SubscribeToPersistentSubscriptionOptions esdb.SubscribeToPersistentSubscriptionOptions
 	PersistentStreamSubscriptionOptions      esdb.PersistentStreamSubscriptionOptions
 	SubscriptionGroup                        string
+	// Start catch-up subscriptions with the first event created at or after FromTime, instead of SubscribeToStreamOptions.From.
+	// It's resolved for each topic when subscribing, see Subscriber.PositionAt. Not used by persistent subscriptions.
+	FromTime time.Time
+	// How often the lag of subscriptions is measured. Defaults to DefaultLagInterval, negative disables it.
+	LagInterval time.Duration
+	// Called when a catch-up subscription becomes live or falls behind. Optional.
+	// It's called from the subscription's goroutine, so it must not block.
+	OnStateChange func(topic string, state SubscriptionState)
+	// How long Close waits for handlers to ack in-flight messages before abandoning them.
+	// By default, Close doesn't wait.
+	CloseTimeout time.Duration
+	// Resubscribe when a subscription is dropped, unless the error is permanent like failed authentication.
+	Resubscribe bool
+	// Delay between resubscribe attempts. Defaults to DefaultResubscribeDelay.
+	ResubscribeDelay time.Duration
+	// Called when a subscription ends because of an error, after resubscribing gave up. Optional.
+	// See CloseRouterOnSubscriptionError.
+	OnSubscriptionError func(topic string, err error)
 }
 
 type Config struct {
@@ -21,6 +41,9 @@ type Config struct {
 	Publisher        PublisherConfig
 	Subscriber       SubscriberConfig
 	Marshaler        Marshaler
+	Tracing          TracingConfig
+	// Metrics collected by publishers and subscribers. Optional.
+	Metrics *Metrics
 }
 
 // Config for simple catch up subcription.
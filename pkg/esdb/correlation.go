@@ -0,0 +1,54 @@
+package esdb
+
+import (
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+)
+
+// EventStoreDB reads correlation and causation IDs from these metadata keys, for example in the $by_correlation_id projection.
+// The Watermill correlation ID (as set by middleware.CorrelationID) and CausationIDMetadataKey are mapped onto them.
+const (
+	EventStoreCorrelationIDKey = "$correlationId"
+	EventStoreCausationIDKey   = "$causationId"
+
+	CausationIDMetadataKey = "causation_id"
+)
+
+// CausationID is a router middleware setting the causation ID of the messages produced by a handler
+// to the UUID of the message it consumed.
+func CausationID(h message.HandlerFunc) message.HandlerFunc {
+	return func(msg *message.Message) ([]*message.Message, error) {
+		producedMessages, err := h(msg)
+
+		for _, producedMessage := range producedMessages {
+			if producedMessage.Metadata.Get(CausationIDMetadataKey) == "" {
+				producedMessage.Metadata.Set(CausationIDMetadataKey, msg.UUID)
+			}
+		}
+
+		return producedMessages, err
+	}
+}
+
+// setEventStoreIDs maps the Watermill correlation and causation IDs onto EventStoreDB metadata keys.
+func setEventStoreIDs(metadata message.Metadata) {
+	if correlationID := metadata.Get(middleware.CorrelationIDMetadataKey); correlationID != "" {
+		metadata.Set(EventStoreCorrelationIDKey, correlationID)
+	}
+	if causationID := metadata.Get(CausationIDMetadataKey); causationID != "" {
+		metadata.Set(EventStoreCausationIDKey, causationID)
+	}
+}
+
+// restoreEventStoreIDs maps the EventStoreDB correlation and causation IDs back onto Watermill metadata keys.
+func restoreEventStoreIDs(metadata message.Metadata) {
+	if correlationID := metadata.Get(EventStoreCorrelationIDKey); correlationID != "" && metadata.Get(middleware.CorrelationIDMetadataKey) == "" {
+		metadata.Set(middleware.CorrelationIDMetadataKey, correlationID)
+	}
+	if causationID := metadata.Get(EventStoreCausationIDKey); causationID != "" && metadata.Get(CausationIDMetadataKey) == "" {
+		metadata.Set(CausationIDMetadataKey, causationID)
+	}
+
+	delete(metadata, EventStoreCorrelationIDKey)
+	delete(metadata, EventStoreCausationIDKey)
+}
@@ -0,0 +1,63 @@
+package esdb_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/EventStore/EventStore-Client-Go/v4/esdb"
+	wesdb "github.com/KirylJazzSax/watermill-eventstore/pkg/esdb"
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCorrelationIDsRoundTrip(t *testing.T) {
+	marshaler := wesdb.DefaultMarshaler{}
+	messageToMarshal := message.NewMessage(watermill.NewUUID(), []byte(`{}`))
+	middleware.SetCorrelationID("correlation-1", messageToMarshal)
+	messageToMarshal.Metadata.Set(wesdb.CausationIDMetadataKey, "causation-1")
+
+	eventData, err := marshaler.Marshal(messageToMarshal)
+	require.NoError(t, err)
+
+	var metadata map[string]string
+	require.NoError(t, json.Unmarshal(eventData.Metadata, &metadata))
+	assert.Equal(t, "correlation-1", metadata[wesdb.EventStoreCorrelationIDKey])
+	assert.Equal(t, "causation-1", metadata[wesdb.EventStoreCausationIDKey])
+
+	m, err := marshaler.Unmarshal(marshalToResolvedEvent(t, marshaler, messageToMarshal))
+	require.NoError(t, err)
+	assert.Equal(t, "correlation-1", middleware.MessageCorrelationID(m))
+	assert.Equal(t, "causation-1", m.Metadata.Get(wesdb.CausationIDMetadataKey))
+	assert.NotContains(t, m.Metadata, wesdb.EventStoreCorrelationIDKey)
+}
+
+func TestCorrelationIDsFromOtherProducers(t *testing.T) {
+	marshaler := wesdb.InteropMarshaler{}
+
+	m, err := marshaler.Unmarshal(&esdb.ResolvedEvent{
+		Event: &esdb.RecordedEvent{
+			EventID:      uuid.New(),
+			UserMetadata: []byte(`{"$correlationId":"correlation-1","$causationId":"causation-1"}`),
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "correlation-1", middleware.MessageCorrelationID(m))
+	assert.Equal(t, "causation-1", m.Metadata.Get(wesdb.CausationIDMetadataKey))
+}
+
+func TestCausationIDMiddleware(t *testing.T) {
+	consumed := message.NewMessage(watermill.NewUUID(), nil)
+
+	handler := wesdb.CausationID(func(msg *message.Message) ([]*message.Message, error) {
+		return []*message.Message{message.NewMessage(watermill.NewUUID(), nil)}, nil
+	})
+
+	produced, err := handler(consumed)
+	require.NoError(t, err)
+	require.Len(t, produced, 1)
+	assert.Equal(t, consumed.UUID, produced[0].Metadata.Get(wesdb.CausationIDMetadataKey))
+}
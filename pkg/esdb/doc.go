@@ -7,4 +7,48 @@
 // - Persistent subscription
 //
 // - Consumer groups
+//
+// - EventStoreDB errors classified by code (ClassifyError)
+//
+// - Binary payloads stored with a binary content type
+//
+// - Consuming events written by non-Watermill producers (InteropMarshaler)
+//
+// - Protobuf payloads (ProtobufMarshaler)
+//
+// - CloudEvents 1.0 (CloudEventsMarshaler)
+//
+// - Typed events mapped to event types and versions (EventRegistry)
+//
+// - Upcasting of old event versions on consume (UpcastingMarshaler)
+//
+// - Payload compression with gzip or zstd (CompressingMarshaler)
+//
+// - Per-subject encryption and crypto-shredding (EncryptingMarshaler)
+//
+// - Claim-check for oversized payloads (ClaimCheckMarshaler)
+//
+// - JSON Schema validation on publish and consume (ValidatingMarshaler)
+//
+// - Correlation and causation IDs in EventStoreDB's native metadata
+//
+// - OpenTelemetry tracing with W3C trace context propagated in event metadata
+//
+// - Prometheus metrics of appends, deliveries, acks, nacks, unmarshal failures and parked events (Metrics)
+//
+// - Consumer lag of catch-up and persistent subscriptions (Subscriber.Lag)
+//
+// - Caught-up and fell-behind notifications of catch-up subscriptions (Subscriber.Ready)
+//
+// - Health checks of publishers and subscribers, with an HTTP handler for probes (HealthHandler)
+//
+// - Graceful drain of in-flight messages on close (SubscriberConfig.CloseTimeout)
+//
+// - Terminal subscription errors (Subscriber.Err) and optional resubscribing after drops
+//
+// - Subscriptions from a point in time (SubscriberConfig.FromTime, Reader.AllPositionAt)
+//
+// - Reading streams once, forwards or backwards, as an iterator or a channel (Reader)
+//
+// - Atomic appends with an expected revision (Publisher.Append), used by the eventsourcing package
 package esdb
@@ -0,0 +1,91 @@
+package esdb
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+)
+
+// AbandonedMessage is a message which wasn't acked before the subscriber closed.
+type AbandonedMessage struct {
+	Topic string
+	UUID  string
+}
+
+// abandonedMessages collects messages abandoned while closing the subscriber.
+type abandonedMessages struct {
+	lock     sync.Mutex
+	messages []AbandonedMessage
+}
+
+func (a *abandonedMessages) add(topic string, uuid string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.messages = append(a.messages, AbandonedMessage{Topic: topic, UUID: uuid})
+}
+
+func (a *abandonedMessages) list() []AbandonedMessage {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	return append([]AbandonedMessage(nil), a.messages...)
+}
+
+// report logs the abandoned messages, if any.
+func (a *abandonedMessages) report(logger watermill.LoggerAdapter) {
+	messages := a.list()
+	if len(messages) == 0 {
+		return
+	}
+
+	uuids := make([]string, 0, len(messages))
+	for _, m := range messages {
+		uuids = append(uuids, m.Topic+"/"+m.UUID)
+	}
+
+	logger.Info("abandoned in-flight messages on close", watermill.LogFields{
+		"count":    len(messages),
+		"messages": uuids,
+	})
+}
+
+// waitTimeout waits for wg, at most for timeout. It reports whether wg finished in time.
+func waitTimeout(wg *sync.WaitGroup, timeout time.Duration) bool {
+	if timeout <= 0 {
+		return false
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// Abandoned returns messages which weren't acked before the subscriber closed.
+// Abandoned events of persistent subscriptions are nacked with esdb.NackActionRetry, so they are redelivered.
+func (s *Subscriber) Abandoned() []AbandonedMessage {
+	return s.abandoned.list()
+}
+
+// isDraining reports whether Close was called, so no more events should be pulled.
+func (s *Subscriber) isDraining() bool {
+	select {
+	case <-s.draining:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,90 @@
+package esdb
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newDrainingTestSubscriber() *Subscriber {
+	return &Subscriber{
+		logger:    watermill.NopLogger{},
+		closing:   make(chan struct{}),
+		draining:  make(chan struct{}),
+		abandoned: &abandonedMessages{},
+	}
+}
+
+func TestSendMessageAckedWhileDraining(t *testing.T) {
+	subscriber := newDrainingTestSubscriber()
+	out := make(chan *message.Message)
+	acked := make(chan bool)
+
+	go func() {
+		acked <- subscriber.sendMessage(context.Background(), "orders", message.NewMessage("1", nil), out)
+	}()
+
+	m := <-out
+	close(subscriber.draining)
+	m.Ack()
+
+	assert.True(t, <-acked, "in-flight message can be acked while draining")
+}
+
+func TestSendMessageNotDeliveredWhileDraining(t *testing.T) {
+	subscriber := newDrainingTestSubscriber()
+	close(subscriber.draining)
+
+	acked := subscriber.sendMessage(context.Background(), "orders", message.NewMessage("1", nil), make(chan *message.Message))
+	assert.False(t, acked)
+}
+
+func TestSendMessageAbandonedWhenClosed(t *testing.T) {
+	subscriber := newDrainingTestSubscriber()
+	out := make(chan *message.Message)
+	acked := make(chan bool)
+
+	go func() {
+		acked <- subscriber.sendMessage(context.Background(), "orders", message.NewMessage("1", nil), out)
+	}()
+
+	<-out
+	close(subscriber.draining)
+	close(subscriber.closing)
+
+	assert.False(t, <-acked)
+}
+
+func TestWaitTimeout(t *testing.T) {
+	wg := &sync.WaitGroup{}
+	assert.True(t, waitTimeout(wg, time.Second))
+
+	wg.Add(1)
+	assert.False(t, waitTimeout(wg, 0), "zero timeout doesn't wait")
+	assert.False(t, waitTimeout(wg, 10*time.Millisecond))
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		wg.Done()
+	}()
+	assert.True(t, waitTimeout(wg, time.Second))
+}
+
+func TestAbandoned(t *testing.T) {
+	subscriber := newDrainingTestSubscriber()
+	require.Empty(t, subscriber.Abandoned())
+
+	subscriber.abandoned.add("orders", "1")
+	subscriber.abandoned.add("payments", "2")
+
+	assert.Equal(t, []AbandonedMessage{
+		{Topic: "orders", UUID: "1"},
+		{Topic: "payments", UUID: "2"},
+	}, subscriber.Abandoned())
+}
@@ -0,0 +1,141 @@
+package esdb
+
+import (
+	"errors"
+
+	"github.com/EventStore/EventStore-Client-Go/v4/esdb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrorClass groups EventStoreDB errors by the way callers are expected to react to them.
+type ErrorClass string
+
+const (
+	ErrorClassNone                 ErrorClass = ""
+	ErrorClassUnknown              ErrorClass = "unknown"
+	ErrorClassAlreadyExists        ErrorClass = "already_exists"
+	ErrorClassNotFound             ErrorClass = "not_found"
+	ErrorClassWrongExpectedVersion ErrorClass = "wrong_expected_version"
+	ErrorClassStreamDeleted        ErrorClass = "stream_deleted"
+	ErrorClassAuth                 ErrorClass = "auth"
+	ErrorClassUnavailable          ErrorClass = "unavailable"
+	ErrorClassClosed               ErrorClass = "closed"
+	ErrorClassUnsupported          ErrorClass = "unsupported"
+	ErrorClassInvalid              ErrorClass = "invalid"
+	// Not an EventStoreDB error, the message couldn't be marshaled.
+	ErrorClassMarshal ErrorClass = "marshal"
+)
+
+// ErrWrongExpectedVersion is wrapped by errors of appends which failed because the stream isn't at the expected revision.
+var ErrWrongExpectedVersion = errors.New("wrong expected version")
+
+// ErrorCode returns the EventStoreDB error code of err.
+//
+// The client library doesn't wrap every error it returns (subscription drops, for example, carry raw gRPC errors),
+// so when err isn't classified by the client, the gRPC status code is used instead.
+func ErrorCode(err error) esdb.ErrorCode {
+	if err == nil {
+		return esdb.ErrorCodeUnknown
+	}
+
+	var esdbErr *esdb.Error
+	if !errors.As(err, &esdbErr) {
+		esdbErr, _ = esdb.FromError(err)
+	}
+
+	if esdbErr.Code() != esdb.ErrorCodeUnknown {
+		return esdbErr.Code()
+	}
+
+	if s, ok := status.FromError(err); ok {
+		return grpcCodeToErrorCode(s.Code())
+	}
+
+	return esdb.ErrorCodeUnknown
+}
+
+func grpcCodeToErrorCode(code codes.Code) esdb.ErrorCode {
+	switch code {
+	case codes.Unauthenticated:
+		return esdb.ErrorCodeUnauthenticated
+	case codes.Unimplemented:
+		return esdb.ErrorCodeUnsupportedFeature
+	case codes.NotFound:
+		return esdb.ErrorCodeResourceNotFound
+	case codes.PermissionDenied:
+		return esdb.ErrorCodeAccessDenied
+	case codes.DeadlineExceeded:
+		return esdb.ErrorCodeDeadlineExceeded
+	case codes.AlreadyExists:
+		return esdb.ErrorCodeResourceAlreadyExists
+	case codes.Aborted:
+		return esdb.ErrorAborted
+	case codes.Unavailable:
+		return esdb.ErrorUnavailable
+	default:
+		return esdb.ErrorCodeUnknown
+	}
+}
+
+// ClassifyError returns the ErrorClass of err, or ErrorClassNone if err is nil.
+func ClassifyError(err error) ErrorClass {
+	if err == nil {
+		return ErrorClassNone
+	}
+	if errors.Is(err, ErrWrongExpectedVersion) {
+		return ErrorClassWrongExpectedVersion
+	}
+
+	switch ErrorCode(err) {
+	case esdb.ErrorCodeResourceAlreadyExists:
+		return ErrorClassAlreadyExists
+	case esdb.ErrorCodeResourceNotFound:
+		return ErrorClassNotFound
+	case esdb.ErrorCodeWrongExpectedVersion:
+		return ErrorClassWrongExpectedVersion
+	case esdb.ErrorCodeStreamDeleted:
+		return ErrorClassStreamDeleted
+	case esdb.ErrorCodeUnauthenticated, esdb.ErrorCodeAccessDenied:
+		return ErrorClassAuth
+	case esdb.ErrorUnavailable,
+		esdb.ErrorAborted,
+		esdb.ErrorCodeDeadlineExceeded,
+		esdb.ErrorCodeNotLeader:
+		return ErrorClassUnavailable
+	case esdb.ErrorCodeConnectionClosed:
+		return ErrorClassClosed
+	case esdb.ErrorCodeUnsupportedFeature:
+		return ErrorClassUnsupported
+	case esdb.ErrorCodeParsing:
+		return ErrorClassInvalid
+	default:
+		return ErrorClassUnknown
+	}
+}
+
+// IsAlreadyExists reports whether err means that the resource being created already exists.
+// Creating persistent subscriptions is idempotent, so such errors can be ignored.
+func IsAlreadyExists(err error) bool {
+	return ClassifyError(err) == ErrorClassAlreadyExists
+}
+
+// IsNotFound reports whether err means that a stream or a subscription doesn't exist.
+func IsNotFound(err error) bool {
+	return ClassifyError(err) == ErrorClassNotFound
+}
+
+// IsWrongExpectedVersion reports whether err is an optimistic concurrency failure.
+func IsWrongExpectedVersion(err error) bool {
+	return ClassifyError(err) == ErrorClassWrongExpectedVersion
+}
+
+// IsStreamDeleted reports whether err means that the stream was deleted.
+func IsStreamDeleted(err error) bool {
+	return ClassifyError(err) == ErrorClassStreamDeleted
+}
+
+// IsTransient reports whether the operation that failed with err may succeed when retried.
+func IsTransient(err error) bool {
+	return ClassifyError(err) == ErrorClassUnavailable
+}
@@ -0,0 +1,71 @@
+package esdb_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/EventStore/EventStore-Client-Go/v4/esdb"
+	wesdb "github.com/KirylJazzSax/watermill-eventstore/pkg/esdb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestClassifyGrpcStatus(t *testing.T) {
+	testCases := []struct {
+		code  codes.Code
+		class wesdb.ErrorClass
+	}{
+		{codes.AlreadyExists, wesdb.ErrorClassAlreadyExists},
+		{codes.NotFound, wesdb.ErrorClassNotFound},
+		{codes.Unauthenticated, wesdb.ErrorClassAuth},
+		{codes.PermissionDenied, wesdb.ErrorClassAuth},
+		{codes.Unavailable, wesdb.ErrorClassUnavailable},
+		{codes.DeadlineExceeded, wesdb.ErrorClassUnavailable},
+		{codes.Aborted, wesdb.ErrorClassUnavailable},
+		{codes.Unimplemented, wesdb.ErrorClassUnsupported},
+		{codes.Internal, wesdb.ErrorClassUnknown},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.code.String(), func(t *testing.T) {
+			err := status.Error(tc.code, "simulated")
+
+			assert.Equal(t, tc.class, wesdb.ClassifyError(err))
+			assert.Equal(t, tc.class, wesdb.ClassifyError(fmt.Errorf("wrapped: %w", err)))
+		})
+	}
+}
+
+func TestClassifyEsdbError(t *testing.T) {
+	esdbErr, _ := esdb.FromError(status.Error(codes.AlreadyExists, "subscription group exists"))
+
+	assert.Equal(t, esdb.ErrorCodeResourceAlreadyExists, wesdb.ErrorCode(esdbErr))
+	assert.True(t, wesdb.IsAlreadyExists(esdbErr))
+	assert.True(t, wesdb.IsAlreadyExists(fmt.Errorf("wrapped: %w", esdbErr)))
+}
+
+func TestClassifyNil(t *testing.T) {
+	assert.Equal(t, wesdb.ErrorClassNone, wesdb.ClassifyError(nil))
+	assert.False(t, wesdb.IsAlreadyExists(nil))
+}
+
+func TestClassifyPlainError(t *testing.T) {
+	err := errors.New("AlreadyExists")
+
+	assert.Equal(t, wesdb.ErrorClassUnknown, wesdb.ClassifyError(err))
+	assert.False(t, wesdb.IsAlreadyExists(err))
+}
+
+func TestClassifyWrongExpectedVersion(t *testing.T) {
+	err := fmt.Errorf("could not publish message: %w", wesdb.ErrWrongExpectedVersion)
+
+	assert.Equal(t, wesdb.ErrorClassWrongExpectedVersion, wesdb.ClassifyError(err))
+	assert.True(t, wesdb.IsWrongExpectedVersion(err))
+}
+
+func TestIsTransient(t *testing.T) {
+	assert.True(t, wesdb.IsTransient(status.Error(codes.Unavailable, "node is down")))
+	assert.False(t, wesdb.IsTransient(status.Error(codes.NotFound, "stream not found")))
+}
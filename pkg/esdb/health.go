@@ -0,0 +1,337 @@
+package esdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/EventStore/EventStore-Client-Go/v4/esdb"
+)
+
+// healthCheckStream is read to check connectivity. It doesn't have to exist, any answer of the server will do.
+const healthCheckStream = "watermill-esdb-health-check"
+
+// SubscriptionStatus is the status of a subscription reported by Subscriber.Health.
+type SubscriptionStatus string
+
+const (
+	SubscriptionStatusRunning      SubscriptionStatus = "running"
+	SubscriptionStatusReconnecting SubscriptionStatus = "reconnecting"
+	SubscriptionStatusDropped      SubscriptionStatus = "dropped"
+)
+
+type SubscriptionHealth struct {
+	Topic             string
+	SubscriptionGroup string
+	Status            SubscriptionStatus
+	// State of catch-up subscriptions, empty for persistent subscriptions.
+	State     SubscriptionState
+	LastError error
+}
+
+type Health struct {
+	// Connected reports whether the cluster answered the connectivity check.
+	Connected bool
+	// Error of the connectivity check.
+	Error error
+	// Subscriptions of a subscriber, sorted by topic and in the order they were subscribed.
+	Subscriptions []SubscriptionHealth
+	LastError     error
+}
+
+// Healthy reports whether the cluster is reachable and no subscription was dropped.
+func (h Health) Healthy() bool {
+	if !h.Connected {
+		return false
+	}
+
+	for _, subscription := range h.Subscriptions {
+		if subscription.Status == SubscriptionStatusDropped {
+			return false
+		}
+	}
+
+	return true
+}
+
+// HealthChecker is implemented by Publisher and Subscriber.
+type HealthChecker interface {
+	Health(ctx context.Context) Health
+}
+
+type subscriptionHealthResponse struct {
+	Topic             string             `json:"topic"`
+	SubscriptionGroup string             `json:"subscription_group,omitempty"`
+	Status            SubscriptionStatus `json:"status"`
+	State             SubscriptionState  `json:"state,omitempty"`
+	LastError         string             `json:"last_error,omitempty"`
+}
+
+type healthResponse struct {
+	Healthy       bool                         `json:"healthy"`
+	Connected     bool                         `json:"connected"`
+	Error         string                       `json:"error,omitempty"`
+	Subscriptions []subscriptionHealthResponse `json:"subscriptions,omitempty"`
+	LastError     string                       `json:"last_error,omitempty"`
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	return err.Error()
+}
+
+// HealthHandler returns an HTTP handler for liveness and readiness probes.
+// It responds with the health of checkers as JSON, with status 503 when any of them is unhealthy.
+func HealthHandler(checkers ...HealthChecker) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		responses := make([]healthResponse, 0, len(checkers))
+		healthy := true
+
+		for _, checker := range checkers {
+			health := checker.Health(r.Context())
+			healthy = healthy && health.Healthy()
+
+			response := healthResponse{
+				Healthy:   health.Healthy(),
+				Connected: health.Connected,
+				Error:     errorString(health.Error),
+				LastError: errorString(health.LastError),
+			}
+			for _, subscription := range health.Subscriptions {
+				response.Subscriptions = append(response.Subscriptions, subscriptionHealthResponse{
+					Topic:             subscription.Topic,
+					SubscriptionGroup: subscription.SubscriptionGroup,
+					Status:            subscription.Status,
+					State:             subscription.State,
+					LastError:         errorString(subscription.LastError),
+				})
+			}
+			responses = append(responses, response)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if !healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = json.NewEncoder(w).Encode(responses)
+	})
+}
+
+// checkConnection reads a single event of healthCheckStream.
+// Errors meaning that the server answered, like a missing stream or denied access, don't fail the check.
+func checkConnection(ctx context.Context, client streamReader, credentials *esdb.Credentials) error {
+	read, err := client.ReadStream(ctx, healthCheckStream, esdb.ReadStreamOptions{
+		Direction:     esdb.Backwards,
+		From:          esdb.End{},
+		Authenticated: credentials,
+	}, 1)
+	if err == nil {
+		defer read.Close()
+		_, err = read.Recv()
+	}
+
+	if err == nil || errors.Is(err, io.EOF) {
+		return nil
+	}
+
+	switch ClassifyError(err) {
+	case ErrorClassUnavailable, ErrorClassClosed, ErrorClassUnknown:
+		return err
+	default:
+		return nil
+	}
+}
+
+type subscriptionHealthState struct {
+	status    SubscriptionStatus
+	lastError error
+	// err terminated the subscription.
+	err error
+}
+
+// healthTracker keeps the status of each subscription and the last errors.
+type healthTracker struct {
+	lock          sync.Mutex
+	subscriptions map[subscriptionKey]*subscriptionHealthState
+	lastError     error
+}
+
+func newHealthTracker() *healthTracker {
+	return &healthTracker{
+		subscriptions: map[subscriptionKey]*subscriptionHealthState{},
+	}
+}
+
+func (t *healthTracker) setStatus(key subscriptionKey, status SubscriptionStatus) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	subscription, ok := t.subscriptions[key]
+	if !ok {
+		subscription = &subscriptionHealthState{}
+		t.subscriptions[key] = subscription
+	}
+	subscription.status = status
+	if status != SubscriptionStatusDropped {
+		subscription.err = nil
+	}
+}
+
+// setLastError records err as the last error.
+func (t *healthTracker) setLastError(err error) {
+	if err == nil {
+		return
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.lastError = err
+}
+
+// setError records err as the last error, and as the last error of the subscription.
+func (t *healthTracker) setError(key subscriptionKey, err error) {
+	if err == nil {
+		return
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.lastError = err
+	if subscription, ok := t.subscriptions[key]; ok {
+		subscription.lastError = err
+	}
+}
+
+// terminate marks the subscription as dropped with err.
+func (t *healthTracker) terminate(key subscriptionKey, err error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	subscription, ok := t.subscriptions[key]
+	if !ok {
+		subscription = &subscriptionHealthState{}
+		t.subscriptions[key] = subscription
+	}
+	subscription.status = SubscriptionStatusDropped
+	subscription.lastError = err
+	subscription.err = err
+	t.lastError = err
+}
+
+// terminalError returns the error which terminated a subscription to topic.
+func (t *healthTracker) terminalError(topic string) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for key, subscription := range t.subscriptions {
+		if key.topic == topic && subscription.err != nil {
+			return subscription.err
+		}
+	}
+	return nil
+}
+
+// allRunning reports whether there are subscriptions and all of them are running.
+func (t *healthTracker) allRunning() bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for _, subscription := range t.subscriptions {
+		if subscription.status != SubscriptionStatusRunning {
+			return false
+		}
+	}
+
+	return len(t.subscriptions) > 0
+}
+
+func (t *healthTracker) remove(key subscriptionKey) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	delete(t.subscriptions, key)
+}
+
+func (t *healthTracker) health(group string, states *subscriptionStates) Health {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	health := Health{LastError: t.lastError}
+	keys := make([]subscriptionKey, 0, len(t.subscriptions))
+	for key := range t.subscriptions {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].topic != keys[j].topic {
+			return keys[i].topic < keys[j].topic
+		}
+		return keys[i].id < keys[j].id
+	})
+
+	for _, key := range keys {
+		subscription := t.subscriptions[key]
+		subscriptionHealth := SubscriptionHealth{
+			Topic:             key.topic,
+			SubscriptionGroup: group,
+			Status:            subscription.status,
+			LastError:         subscription.lastError,
+		}
+		if states != nil {
+			subscriptionHealth.State, _ = states.get(key)
+		}
+		health.Subscriptions = append(health.Subscriptions, subscriptionHealth)
+	}
+
+	return health
+}
+
+// Health reports connectivity to the cluster and the last error of publishing.
+func (p *Publisher) Health(ctx context.Context) Health {
+	health := p.health.health("", nil)
+	health.Error = checkConnection(ctx, p.client, p.config.Publisher.Options.Authenticated)
+	health.Connected = health.Error == nil
+
+	return health
+}
+
+// Health reports connectivity to the cluster, the status of active subscriptions and the last errors.
+func (s *Subscriber) Health(ctx context.Context) Health {
+	health := s.health.health(s.config.Subscriber.SubscriptionGroup, s.states)
+	health.Error = checkConnection(ctx, s.client, s.credentials())
+	health.Connected = health.Error == nil
+
+	return health
+}
+
+func (s *Subscriber) credentials() *esdb.Credentials {
+	if s.config.Subscriber.SubscriptionGroup != "" {
+		return s.config.Subscriber.SubscribeToPersistentSubscriptionOptions.Authenticated
+	}
+
+	return s.config.Subscriber.SubscribeToStreamOptions.Authenticated
+}
+
+// subscriptionEnded forgets the subscription when it ended because ctx is done or the subscriber is closing.
+// Dropped subscriptions are kept, so Health reports them, but what they delivered is forgotten either way.
+func (s *Subscriber) subscriptionEnded(ctx context.Context, key subscriptionKey) {
+	s.lag.remove(key)
+
+	select {
+	case <-s.draining:
+	case <-ctx.Done():
+	default:
+		return
+	}
+
+	s.health.remove(key)
+	s.states.remove(key)
+}
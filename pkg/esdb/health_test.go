@@ -0,0 +1,152 @@
+package esdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type staticHealthChecker Health
+
+func (c staticHealthChecker) Health(context.Context) Health {
+	return Health(c)
+}
+
+func TestSubscriptionHealth(t *testing.T) {
+	subscriber := &Subscriber{
+		config:   Config{Subscriber: SubscriberConfig{SubscriptionGroup: "group"}},
+		logger:   watermill.NopLogger{},
+		draining: make(chan struct{}),
+		states:   newSubscriptionStates(),
+		health:   newHealthTracker(),
+		lag:      newLagTracker(),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	orders := subscriptionKey{topic: "orders", id: 1}
+	payments := subscriptionKey{topic: "payments", id: 2}
+
+	subscriber.health.setStatus(orders, SubscriptionStatusRunning)
+	subscriber.health.setStatus(payments, SubscriptionStatusRunning)
+	subscriber.setSubscriptionState(payments, SubscriptionStateLive)
+
+	dropErr := errors.New("dropped")
+	subscriber.subscriptionTerminated(orders, dropErr)
+	subscriber.subscriptionEnded(ctx, orders)
+
+	health := subscriber.health.health("group", subscriber.states)
+	health.Connected = true
+	assert.False(t, health.Healthy())
+	assert.Equal(t, dropErr, health.LastError)
+	assert.Equal(t, []SubscriptionHealth{
+		{
+			Topic:             "orders",
+			SubscriptionGroup: "group",
+			Status:            SubscriptionStatusDropped,
+			LastError:         dropErr,
+		},
+		{
+			Topic:             "payments",
+			SubscriptionGroup: "group",
+			Status:            SubscriptionStatusRunning,
+			State:             SubscriptionStateLive,
+		},
+	}, health.Subscriptions)
+
+	cancel()
+	subscriber.subscriptionEnded(ctx, payments)
+
+	health = subscriber.health.health("group", subscriber.states)
+	require.Len(t, health.Subscriptions, 1, "subscriptions ended by their context are forgotten")
+	assert.Equal(t, "orders", health.Subscriptions[0].Topic)
+}
+
+func TestSubscriptionsToSameTopicHaveOwnHealth(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	backend := &memoryBackend{}
+	subscriber := newTestSubscriber(backend, SubscriberConfig{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first, err := subscriber.Subscribe(ctx, "orders")
+	require.NoError(t, err)
+	second, err := subscriber.Subscribe(context.Background(), "orders")
+	require.NoError(t, err)
+	_, err = subscriber.Subscribe(context.Background(), "orders")
+	require.NoError(t, err)
+
+	dropErr := status.Error(codes.Unavailable, "server is gone")
+	backend.catchUpSubscription(t, 1).drop(dropErr)
+	requireClosed(t, second)
+	cancel()
+	requireClosed(t, first)
+
+	health := subscriber.health.health("", subscriber.states)
+	require.Len(t, health.Subscriptions, 2, "only the subscription ended by its context is forgotten")
+	assert.Equal(t, SubscriptionStatusDropped, health.Subscriptions[0].Status)
+	assert.Equal(t, dropErr, health.Subscriptions[0].LastError)
+	assert.Equal(t, SubscriptionStatusRunning, health.Subscriptions[1].Status)
+	assert.Equal(t, dropErr, subscriber.Err("orders"))
+
+	closeWithin(t, subscriber, time.Second)
+}
+
+func TestHealthHandler(t *testing.T) {
+	healthy := staticHealthChecker{
+		Connected: true,
+		Subscriptions: []SubscriptionHealth{
+			{Topic: "orders", Status: SubscriptionStatusRunning, State: SubscriptionStateLive},
+		},
+	}
+	dropped := staticHealthChecker{
+		Connected: true,
+		Subscriptions: []SubscriptionHealth{
+			{Topic: "orders", Status: SubscriptionStatusDropped, LastError: errors.New("dropped")},
+		},
+	}
+	disconnected := staticHealthChecker{
+		Error: errors.New("unavailable"),
+	}
+
+	testCases := []struct {
+		name     string
+		checkers []HealthChecker
+		status   int
+	}{
+		{name: "healthy", checkers: []HealthChecker{healthy}, status: http.StatusOK},
+		{name: "dropped subscription", checkers: []HealthChecker{healthy, dropped}, status: http.StatusServiceUnavailable},
+		{name: "disconnected", checkers: []HealthChecker{disconnected}, status: http.StatusServiceUnavailable},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			HealthHandler(tc.checkers...).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+			assert.Equal(t, tc.status, recorder.Code)
+			assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+
+			var responses []map[string]any
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &responses))
+			assert.Len(t, responses, len(tc.checkers))
+		})
+	}
+
+	recorder := httptest.NewRecorder()
+	HealthHandler(dropped).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/health", nil))
+	assert.JSONEq(t, `[{
+		"healthy": false,
+		"connected": true,
+		"subscriptions": [{"topic": "orders", "status": "dropped", "last_error": "dropped"}]
+	}]`, recorder.Body.String())
+}
@@ -0,0 +1,210 @@
+package esdb
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+var ErrKeyNotFound = errors.New("data key not found")
+
+const dataKeySize = 32
+
+// KeyStore manages the per-subject data keys used by EncryptingMarshaler.
+type KeyStore interface {
+	// DataKey returns the data key of subjectID, creating one when the subject has none.
+	DataKey(ctx context.Context, subjectID string) (keyID string, key []byte, err error)
+	// Key returns the data key with keyID, or ErrKeyNotFound when it doesn't exist.
+	Key(ctx context.Context, keyID string) ([]byte, error)
+	// DeleteSubject deletes the data key of subjectID, which makes the events encrypted with it unreadable.
+	DeleteSubject(ctx context.Context, subjectID string) error
+}
+
+func newDataKey() (string, []byte, error) {
+	key := make([]byte, dataKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", nil, fmt.Errorf("can't generate data key: %w", err)
+	}
+
+	return uuid.NewString(), key, nil
+}
+
+// MemoryKeyStore keeps data keys in memory. It's meant for tests and single-process tools.
+type MemoryKeyStore struct {
+	lock     sync.Mutex
+	subjects map[string]string
+	keys     map[string][]byte
+}
+
+func NewMemoryKeyStore() *MemoryKeyStore {
+	return &MemoryKeyStore{
+		subjects: map[string]string{},
+		keys:     map[string][]byte{},
+	}
+}
+
+func (s *MemoryKeyStore) DataKey(_ context.Context, subjectID string) (string, []byte, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if keyID, ok := s.subjects[subjectID]; ok {
+		return keyID, s.keys[keyID], nil
+	}
+
+	keyID, key, err := newDataKey()
+	if err != nil {
+		return "", nil, err
+	}
+
+	s.subjects[subjectID] = keyID
+	s.keys[keyID] = key
+	return keyID, key, nil
+}
+
+func (s *MemoryKeyStore) Key(_ context.Context, keyID string) ([]byte, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	key, ok := s.keys[keyID]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+
+	return key, nil
+}
+
+func (s *MemoryKeyStore) DeleteSubject(_ context.Context, subjectID string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if keyID, ok := s.subjects[subjectID]; ok {
+		delete(s.keys, keyID)
+		delete(s.subjects, subjectID)
+	}
+
+	return nil
+}
+
+// FileKeyStore keeps data keys as files in a directory.
+// Subject IDs are hashed, so the directory doesn't reveal them.
+type FileKeyStore struct {
+	dir  string
+	lock sync.Mutex
+}
+
+func NewFileKeyStore(dir string) (*FileKeyStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("can't create key store directory: %w", err)
+	}
+
+	return &FileKeyStore{dir: dir}, nil
+}
+
+func (s *FileKeyStore) subjectPath(subjectID string) string {
+	hash := sha256.Sum256([]byte(subjectID))
+	return filepath.Join(s.dir, "subject-"+hex.EncodeToString(hash[:]))
+}
+
+func (s *FileKeyStore) keyPath(keyID string) (string, error) {
+	if _, err := uuid.Parse(keyID); err != nil {
+		return "", fmt.Errorf("invalid key id %q", keyID)
+	}
+
+	return filepath.Join(s.dir, "key-"+keyID), nil
+}
+
+func (s *FileKeyStore) DataKey(_ context.Context, subjectID string) (string, []byte, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	subjectPath := s.subjectPath(subjectID)
+	storedKeyID, err := os.ReadFile(subjectPath)
+	if err == nil {
+		keyID := strings.TrimSpace(string(storedKeyID))
+		key, err := s.readKey(keyID)
+		return keyID, key, err
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return "", nil, fmt.Errorf("can't read subject key id: %w", err)
+	}
+
+	keyID, key, err := newDataKey()
+	if err != nil {
+		return "", nil, err
+	}
+
+	keyPath, err := s.keyPath(keyID)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := os.WriteFile(keyPath, []byte(hex.EncodeToString(key)), 0o600); err != nil {
+		return "", nil, fmt.Errorf("can't write data key: %w", err)
+	}
+	if err := os.WriteFile(subjectPath, []byte(keyID), 0o600); err != nil {
+		return "", nil, fmt.Errorf("can't write subject key id: %w", err)
+	}
+
+	return keyID, key, nil
+}
+
+func (s *FileKeyStore) Key(_ context.Context, keyID string) ([]byte, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.readKey(keyID)
+}
+
+func (s *FileKeyStore) readKey(keyID string) ([]byte, error) {
+	keyPath, err := s.keyPath(keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded, err := os.ReadFile(keyPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrKeyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't read data key: %w", err)
+	}
+
+	key, err := hex.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return nil, fmt.Errorf("can't decode data key: %w", err)
+	}
+
+	return key, nil
+}
+
+func (s *FileKeyStore) DeleteSubject(_ context.Context, subjectID string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	subjectPath := s.subjectPath(subjectID)
+	keyID, err := os.ReadFile(subjectPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("can't read subject key id: %w", err)
+	}
+
+	keyPath, err := s.keyPath(strings.TrimSpace(string(keyID)))
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(keyPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("can't delete data key: %w", err)
+	}
+
+	return os.Remove(subjectPath)
+}
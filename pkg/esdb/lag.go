@@ -0,0 +1,279 @@
+package esdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/EventStore/EventStore-Client-Go/v4/esdb"
+	"github.com/ThreeDotsLabs/watermill"
+)
+
+// DefaultLagInterval is how often subscribers measure their lag when SubscriberConfig.LagInterval isn't set.
+const DefaultLagInterval = 30 * time.Second
+
+// ErrLagUnknown is returned by Subscriber.Lag before the lag of a topic is measured.
+var ErrLagUnknown = errors.New("lag is not measured yet")
+
+// lagTracker keeps the start position, the last delivered revision and the measured lag of each subscription.
+type lagTracker struct {
+	lock      sync.Mutex
+	starts    map[subscriptionKey]esdb.StreamPosition
+	delivered map[subscriptionKey]uint64
+	lags      map[subscriptionKey]uint64
+}
+
+func newLagTracker() *lagTracker {
+	return &lagTracker{
+		starts:    map[subscriptionKey]esdb.StreamPosition{},
+		delivered: map[subscriptionKey]uint64{},
+		lags:      map[subscriptionKey]uint64{},
+	}
+}
+
+func (t *lagTracker) setStart(key subscriptionKey, from esdb.StreamPosition) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.starts[key] = from
+}
+
+// start returns the position the subscription started from, or configured when it isn't known.
+func (t *lagTracker) start(key subscriptionKey, configured esdb.StreamPosition) esdb.StreamPosition {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if from, ok := t.starts[key]; ok {
+		return from
+	}
+	return configured
+}
+
+func (t *lagTracker) setDelivered(key subscriptionKey, event *esdb.ResolvedEvent) {
+	recorded := event.OriginalEvent()
+	if recorded == nil {
+		return
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.delivered[key] = recorded.EventNumber
+}
+
+func (t *lagTracker) lastDelivered(key subscriptionKey) (uint64, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	revision, ok := t.delivered[key]
+	return revision, ok
+}
+
+// setLag stores the lag of the subscription and returns the lag of its topic.
+func (t *lagTracker) setLag(key subscriptionKey, lag uint64) uint64 {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.lags[key] = lag
+	topicLag, _ := t.topicLag(key.topic)
+	return topicLag
+}
+
+// removeLag forgets the lag of the subscription and returns the lag of the other subscriptions to its topic.
+// It reports false when there are none.
+func (t *lagTracker) removeLag(key subscriptionKey) (uint64, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	delete(t.lags, key)
+	return t.topicLag(key.topic)
+}
+
+// remove forgets where the subscription started and what it delivered.
+func (t *lagTracker) remove(key subscriptionKey) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	delete(t.starts, key)
+	delete(t.delivered, key)
+}
+
+func (t *lagTracker) lag(topic string) (uint64, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return t.topicLag(topic)
+}
+
+// topicLag returns the lag of the subscription to topic furthest behind. It must be called with the lock held.
+func (t *lagTracker) topicLag(topic string) (uint64, bool) {
+	var lag uint64
+	found := false
+	for key, subscriptionLag := range t.lags {
+		if key.topic == topic {
+			lag = max(lag, subscriptionLag)
+			found = true
+		}
+	}
+
+	return lag, found
+}
+
+// catchUpLag returns the number of events of a stream, ending at lastRevision, which weren't delivered yet.
+// Before anything is delivered, the lag depends on where the subscription started.
+func catchUpLag(lastRevision uint64, delivered uint64, isDelivered bool, from esdb.StreamPosition) uint64 {
+	if isDelivered {
+		if lastRevision <= delivered {
+			return 0
+		}
+		return lastRevision - delivered
+	}
+
+	switch from := from.(type) {
+	case esdb.End:
+		return 0
+	case esdb.StreamRevision:
+		if lastRevision <= from.Value {
+			return 0
+		}
+		return lastRevision - from.Value
+	default:
+		return lastRevision + 1
+	}
+}
+
+// persistentLag returns the number of events between the last checkpoint of a persistent subscription and the end of its stream.
+func persistentLag(stats *esdb.PersistentSubscriptionStats) uint64 {
+	if stats == nil || stats.LastKnownEventRevision == nil {
+		return 0
+	}
+
+	known := *stats.LastKnownEventRevision
+	if stats.LastCheckpointedEventRevision == nil {
+		return known + 1
+	}
+
+	checkpointed := *stats.LastCheckpointedEventRevision
+	if known <= checkpointed {
+		return 0
+	}
+	return known - checkpointed
+}
+
+// Lag returns the number of events of topic the subscriber didn't handle yet, as of the last measurement.
+// With several subscriptions to topic, it's the lag of the one furthest behind.
+func (s *Subscriber) Lag(topic string) (uint64, error) {
+	lag, ok := s.lag.lag(topic)
+	if !ok {
+		return 0, ErrLagUnknown
+	}
+
+	return lag, nil
+}
+
+func (s *Subscriber) lagInterval() time.Duration {
+	if s.config.Subscriber.LagInterval == 0 {
+		return DefaultLagInterval
+	}
+
+	return s.config.Subscriber.LagInterval
+}
+
+// watchLag measures the lag of the subscription periodically until ctx is done or the subscriber is closing.
+// The lag is forgotten when it stops, so it doesn't go stale.
+func (s *Subscriber) watchLag(ctx context.Context, key subscriptionKey) {
+	topic := key.topic
+	interval := s.lagInterval()
+	if interval < 0 {
+		return
+	}
+
+	s.subscriberWg.Add(1)
+	go func() {
+		defer s.subscriberWg.Done()
+		defer s.forgetLag(key)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			measureCtx, cancel := context.WithTimeout(ctx, interval)
+			lag, err := s.measureLag(measureCtx, key)
+			cancel()
+			if err != nil {
+				s.health.setError(key, err)
+				s.logger.Error("can't measure lag", err, watermill.LogFields{
+					"topic":              topic,
+					"subscription-group": s.config.Subscriber.SubscriptionGroup,
+					"error-class":        ClassifyError(err),
+				})
+			} else {
+				topicLag := s.lag.setLag(key, lag)
+				s.config.Metrics.lagMeasured(topic, s.config.Subscriber.SubscriptionGroup, topicLag)
+			}
+
+			select {
+			case <-s.draining:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// forgetLag removes the lag of the subscription, leaving the lag of the other subscriptions to its topic in the metrics.
+func (s *Subscriber) forgetLag(key subscriptionKey) {
+	group := s.config.Subscriber.SubscriptionGroup
+	if lag, ok := s.lag.removeLag(key); ok {
+		s.config.Metrics.lagMeasured(key.topic, group, lag)
+	} else {
+		s.config.Metrics.lagRemoved(key.topic, group)
+	}
+}
+
+func (s *Subscriber) measureLag(ctx context.Context, key subscriptionKey) (uint64, error) {
+	topic := key.topic
+	if s.config.Subscriber.SubscriptionGroup != "" {
+		info, err := s.client.GetPersistentSubscriptionInfo(
+			ctx,
+			topic,
+			s.config.Subscriber.SubscriptionGroup,
+			esdb.GetPersistentSubscriptionOptions{
+				Authenticated: s.config.Subscriber.SubscribeToPersistentSubscriptionOptions.Authenticated,
+			},
+		)
+		if err != nil {
+			return 0, fmt.Errorf("can't get persistent subscription info: %w", err)
+		}
+		if info.Stats != nil {
+			s.config.Metrics.parkedMeasured(topic, s.config.Subscriber.SubscriptionGroup, info.Stats.ParkedMessagesCount)
+		}
+
+		return persistentLag(info.Stats), nil
+	}
+
+	lastRevision, ok, err := s.lastRevision(ctx, topic)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, nil
+	}
+
+	delivered, isDelivered := s.lag.lastDelivered(key)
+	return catchUpLag(lastRevision, delivered, isDelivered, s.lag.start(key, s.config.Subscriber.SubscribeToStreamOptions.From)), nil
+}
+
+// lastRevision reads the last revision of stream backwards. It reports false when the stream is empty or doesn't exist.
+func (s *Subscriber) lastRevision(ctx context.Context, stream string) (uint64, bool, error) {
+	event, err := readEvent(ctx, s.client, stream, esdb.Backwards, esdb.End{}, s.config.Subscriber.SubscribeToStreamOptions.Authenticated)
+	if err != nil || event == nil {
+		return 0, false, err
+	}
+
+	return event.EventNumber, true, nil
+}
@@ -0,0 +1,174 @@
+package esdb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/EventStore/EventStore-Client-Go/v4/esdb"
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+func TestCatchUpLag(t *testing.T) {
+	testCases := []struct {
+		name         string
+		lastRevision uint64
+		delivered    uint64
+		isDelivered  bool
+		from         esdb.StreamPosition
+		expected     uint64
+	}{
+		{name: "delivered", lastRevision: 10, delivered: 7, isDelivered: true, from: esdb.Start{}, expected: 3},
+		{name: "caught up", lastRevision: 10, delivered: 10, isDelivered: true, from: esdb.Start{}, expected: 0},
+		{name: "nothing delivered from start", lastRevision: 10, from: esdb.Start{}, expected: 11},
+		{name: "nothing delivered from end", lastRevision: 10, from: esdb.End{}, expected: 0},
+		{name: "nothing delivered from revision", lastRevision: 10, from: esdb.Revision(4), expected: 6},
+		{name: "nothing delivered without position", lastRevision: 0, expected: 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, catchUpLag(tc.lastRevision, tc.delivered, tc.isDelivered, tc.from))
+		})
+	}
+}
+
+func TestPersistentLag(t *testing.T) {
+	revision := func(revision uint64) *uint64 {
+		return &revision
+	}
+
+	assert.Equal(t, uint64(0), persistentLag(nil))
+	assert.Equal(t, uint64(0), persistentLag(&esdb.PersistentSubscriptionStats{}))
+	assert.Equal(t, uint64(5), persistentLag(&esdb.PersistentSubscriptionStats{
+		LastKnownEventRevision: revision(4),
+	}))
+	assert.Equal(t, uint64(3), persistentLag(&esdb.PersistentSubscriptionStats{
+		LastKnownEventRevision:        revision(10),
+		LastCheckpointedEventRevision: revision(7),
+	}))
+	assert.Equal(t, uint64(0), persistentLag(&esdb.PersistentSubscriptionStats{
+		LastKnownEventRevision:        revision(10),
+		LastCheckpointedEventRevision: revision(10),
+	}))
+}
+
+func TestLagTracker(t *testing.T) {
+	tracker := newLagTracker()
+	first := subscriptionKey{topic: "orders", id: 1}
+	second := subscriptionKey{topic: "orders", id: 2}
+
+	_, ok := tracker.lastDelivered(first)
+	assert.False(t, ok)
+
+	tracker.setDelivered(first, &esdb.ResolvedEvent{Event: &esdb.RecordedEvent{EventNumber: 3}})
+	revision, ok := tracker.lastDelivered(first)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(3), revision)
+	_, ok = tracker.lastDelivered(second)
+	assert.False(t, ok, "subscriptions to the same topic don't share delivered revisions")
+
+	subscriber := &Subscriber{lag: tracker}
+	_, err := subscriber.Lag("orders")
+	assert.ErrorIs(t, err, ErrLagUnknown)
+
+	assert.Equal(t, uint64(42), tracker.setLag(first, 42))
+	assert.Equal(t, uint64(42), tracker.setLag(second, 7), "the topic lags as much as its furthest subscription")
+	lag, err := subscriber.Lag("orders")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(42), lag)
+
+	lag, ok = tracker.removeLag(first)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(7), lag)
+	tracker.remove(first)
+	_, ok = tracker.lastDelivered(first)
+	assert.False(t, ok)
+
+	_, ok = tracker.removeLag(second)
+	assert.False(t, ok)
+	_, err = subscriber.Lag("orders")
+	assert.ErrorIs(t, err, ErrLagUnknown)
+}
+
+func TestLagOfSubscriptionsToSameTopic(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	metrics, err := NewMetrics(prometheus.NewRegistry())
+	require.NoError(t, err)
+
+	backend := &memoryBackend{}
+	for i := range 10 {
+		backend.appendToStream("orders", newTestRecordedEvent(t, watermill.NewUUID(), uint64(i)))
+	}
+	subscriber := newSubscriber(backend, Config{
+		Marshaler:  DefaultMarshaler{},
+		Metrics:    metrics,
+		Subscriber: SubscriberConfig{LagInterval: time.Millisecond},
+	}, watermill.NopLogger{})
+	gauge := metrics.lag.WithLabelValues("orders", "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first, err := subscriber.Subscribe(ctx, "orders")
+	require.NoError(t, err)
+	second, err := subscriber.Subscribe(context.Background(), "orders")
+	require.NoError(t, err)
+
+	backend.catchUpSubscription(t, 1).append(newTestEvent(t, watermill.NewUUID(), 7))
+	receive(t, second).Ack()
+
+	require.Eventually(t, func() bool {
+		lag, err := subscriber.Lag("orders")
+		return err == nil && lag == 10 && testutil.ToFloat64(gauge) == 10
+	}, time.Second, time.Millisecond, "the first subscription didn't handle anything")
+
+	cancel()
+	requireClosed(t, first)
+	require.Eventually(t, func() bool {
+		lag, err := subscriber.Lag("orders")
+		return err == nil && lag == 2 && testutil.ToFloat64(gauge) == 2
+	}, time.Second, time.Millisecond, "only the second subscription is left")
+
+	closeWithin(t, subscriber, time.Second)
+	_, err = subscriber.Lag("orders")
+	assert.ErrorIs(t, err, ErrLagUnknown)
+	assert.Equal(t, 0, testutil.CollectAndCount(metrics.lag), "the lag of ended subscriptions isn't reported")
+}
+
+func TestParkedMessages(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	metrics, err := NewMetrics(prometheus.NewRegistry())
+	require.NoError(t, err)
+
+	backend := &memoryBackend{stats: &esdb.PersistentSubscriptionStats{
+		LastKnownEventRevision:        revision(9),
+		LastCheckpointedEventRevision: revision(4),
+		ParkedMessagesCount:           3,
+	}}
+	subscriber := newSubscriber(backend, Config{
+		Marshaler: DefaultMarshaler{},
+		Metrics:   metrics,
+		Subscriber: SubscriberConfig{
+			SubscriptionGroup: "group",
+			LagInterval:       time.Millisecond,
+		},
+	}, watermill.NopLogger{})
+
+	_, err = subscriber.Subscribe(context.Background(), "orders")
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		lag, err := subscriber.Lag("orders")
+		return err == nil && lag == 5
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, 3.0, testutil.ToFloat64(metrics.parked.WithLabelValues("orders", "group")))
+
+	closeWithin(t, subscriber, time.Second)
+	assert.Equal(t, 0, testutil.CollectAndCount(metrics.parked))
+}
@@ -16,25 +16,147 @@ const (
 	DefaultEventType            = "watermill_event"
 )
 
+// The content type of an event can be chosen per message with the content type metadata key.
+// On consume, the content type stored in EventStoreDB is exposed to handlers under the same key.
+const (
+	DefaultContentTypeKey = "_watermill_content_type"
+
+	ContentTypeJSON   = "application/json"
+	ContentTypeBinary = "application/octet-stream"
+)
+
 type Marshaler interface {
 	Marshal(msg *message.Message) (esdb.EventData, error)
 	Unmarshal(event *esdb.ResolvedEvent) (*message.Message, error)
 }
 
+// DefaultMarshaler stores the message payload as event data and the message metadata as JSON event metadata.
+// Empty fields fall back to the package defaults, so the zero value is ready to use.
 type DefaultMarshaler struct {
+	// Metadata key the Watermill message UUID is stored under.
 	MessageUUIDHeaderKey string
-	EventTypeKey         string
-	EventType            string
+	// Metadata key the event type is taken from.
+	EventTypeKey string
+	// Event type used when the message has no event type in its metadata.
+	EventType string
+	// Metadata key the content type is taken from and exposed under.
+	ContentTypeKey string
+	// Content type used when the message has no content type in its metadata.
+	// When nil, events whose payload is valid JSON are stored as JSON and others as binary.
+	ContentType *esdb.ContentType
+}
+
+type DefaultMarshalerOption func(*DefaultMarshaler)
+
+// WithMessageUUIDHeaderKey sets the metadata key the Watermill message UUID is stored under.
+func WithMessageUUIDHeaderKey(key string) DefaultMarshalerOption {
+	return func(d *DefaultMarshaler) {
+		d.MessageUUIDHeaderKey = key
+	}
+}
+
+// WithEventTypeKey sets the metadata key the event type is taken from.
+func WithEventTypeKey(key string) DefaultMarshalerOption {
+	return func(d *DefaultMarshaler) {
+		d.EventTypeKey = key
+	}
+}
+
+// WithEventType sets the event type used when the message has no event type in its metadata.
+func WithEventType(eventType string) DefaultMarshalerOption {
+	return func(d *DefaultMarshaler) {
+		d.EventType = eventType
+	}
+}
+
+// WithContentTypeKey sets the metadata key the content type is taken from and exposed under.
+func WithContentTypeKey(key string) DefaultMarshalerOption {
+	return func(d *DefaultMarshaler) {
+		d.ContentTypeKey = key
+	}
+}
+
+// WithContentType sets the content type used when the message has no content type in its metadata.
+func WithContentType(contentType esdb.ContentType) DefaultMarshalerOption {
+	return func(d *DefaultMarshaler) {
+		d.ContentType = &contentType
+	}
+}
+
+func NewDefaultMarshaler(options ...DefaultMarshalerOption) DefaultMarshaler {
+	d := DefaultMarshaler{}
+	for _, option := range options {
+		option(&d)
+	}
+
+	return d
+}
+
+func (d DefaultMarshaler) messageUUIDHeaderKey() string {
+	if d.MessageUUIDHeaderKey == "" {
+		return DefaultMessageUUIDHeaderKey
+	}
+
+	return d.MessageUUIDHeaderKey
+}
+
+func (d DefaultMarshaler) eventTypeKey() string {
+	if d.EventTypeKey == "" {
+		return DefaultEventTypeKey
+	}
+
+	return d.EventTypeKey
+}
+
+func (d DefaultMarshaler) eventType() string {
+	if d.EventType == "" {
+		return DefaultEventType
+	}
+
+	return d.EventType
+}
+
+func (d DefaultMarshaler) contentTypeKey() string {
+	if d.ContentTypeKey == "" {
+		return DefaultContentTypeKey
+	}
+
+	return d.ContentTypeKey
+}
+
+func (d DefaultMarshaler) contentType(msg *message.Message) esdb.ContentType {
+	if contentType := msg.Metadata.Get(d.contentTypeKey()); contentType != "" {
+		if contentType == ContentTypeJSON {
+			return esdb.ContentTypeJson
+		}
+
+		return esdb.ContentTypeBinary
+	}
+
+	if d.ContentType != nil {
+		return *d.ContentType
+	}
+
+	return detectContentType(msg.Payload)
+}
+
+func detectContentType(data []byte) esdb.ContentType {
+	if json.Valid(data) {
+		return esdb.ContentTypeJson
+	}
+
+	return esdb.ContentTypeBinary
 }
 
 func (d DefaultMarshaler) Marshal(msg *message.Message) (esdb.EventData, error) {
-	eventType := msg.Metadata.Get(DefaultEventTypeKey)
+	eventType := msg.Metadata.Get(d.eventTypeKey())
 	if eventType == "" {
-		eventType = DefaultEventType
+		eventType = d.eventType()
 	}
 
 	eventMetadata := msg.Copy().Metadata
-	eventMetadata.Set(DefaultMessageUUIDHeaderKey, msg.UUID)
+	eventMetadata.Set(d.messageUUIDHeaderKey(), msg.UUID)
+	setEventStoreIDs(eventMetadata)
 
 	marshaledMetadata, err := json.Marshal(eventMetadata)
 
@@ -43,7 +165,7 @@ func (d DefaultMarshaler) Marshal(msg *message.Message) (esdb.EventData, error)
 	}
 
 	return esdb.EventData{
-		ContentType: esdb.ContentTypeJson,
+		ContentType: d.contentType(msg),
 		EventType:   eventType,
 		Data:        msg.Payload,
 		Metadata:    marshaledMetadata,
@@ -57,8 +179,69 @@ func (d DefaultMarshaler) Unmarshal(event *esdb.ResolvedEvent) (*message.Message
 	if err != nil {
 		return nil, errors.New("couldn't decode metadata")
 	}
+	if metadata == nil {
+		metadata = message.Metadata{}
+	}
+	restoreEventStoreIDs(metadata)
+
+	if event.Event.ContentType != "" {
+		metadata.Set(d.contentTypeKey(), event.Event.ContentType)
+	}
 
-	m := message.NewMessage(metadata.Get(DefaultMessageUUIDHeaderKey), event.Event.Data)
+	m := message.NewMessage(metadata.Get(d.messageUUIDHeaderKey()), event.Event.Data)
 	m.Metadata = metadata
 	return m, nil
 }
+
+// setEventMetadata sets values in JSON encoded event metadata, keeping the values already there.
+// Metadata that isn't a JSON object is replaced.
+func setEventMetadata(metadata []byte, values map[string]string) ([]byte, error) {
+	decoded := map[string]json.RawMessage{}
+	if err := json.Unmarshal(metadata, &decoded); err != nil || decoded == nil {
+		decoded = map[string]json.RawMessage{}
+	}
+
+	for key, value := range values {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		decoded[key] = encoded
+	}
+
+	return json.Marshal(decoded)
+}
+
+// eventMetadataValue returns the string value stored under key in JSON encoded event metadata.
+func eventMetadataValue(metadata []byte, key string) string {
+	var decoded map[string]json.RawMessage
+	if err := json.Unmarshal(metadata, &decoded); err != nil {
+		return ""
+	}
+
+	var value string
+	if err := json.Unmarshal(decoded[key], &value); err != nil {
+		return ""
+	}
+
+	return value
+}
+
+// withEventData returns a copy of event with its data and content type replaced.
+func withEventData(event *esdb.ResolvedEvent, data []byte, contentType string) *esdb.ResolvedEvent {
+	recorded := *event.Event
+	recorded.Data = data
+	recorded.ContentType = contentType
+
+	resolved := *event
+	resolved.Event = &recorded
+	return &resolved
+}
+
+func contentTypeName(contentType esdb.ContentType) string {
+	if contentType == esdb.ContentTypeJson {
+		return ContentTypeJSON
+	}
+
+	return ContentTypeBinary
+}
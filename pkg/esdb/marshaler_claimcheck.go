@@ -0,0 +1,120 @@
+package esdb
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/EventStore/EventStore-Client-Go/v4/esdb"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/google/uuid"
+)
+
+// Claim-checked events are marked in the event metadata, together with the content type of the offloaded data.
+const (
+	DefaultClaimCheckKey            = "_watermill_claim_check"
+	DefaultClaimCheckContentTypeKey = "_watermill_claim_check_content_type"
+)
+
+// ClaimCheck is stored as event data in place of an offloaded payload.
+type ClaimCheck struct {
+	Key    string `json:"key"`
+	SHA256 string `json:"sha256"`
+	Size   int    `json:"size"`
+}
+
+// ClaimCheckMarshaler decorates a Marshaler and offloads event data larger than Threshold to a BlobStore,
+// so events stay below the maximum event size of EventStoreDB.
+//
+// Only a ClaimCheck referencing the blob is stored in the event.
+// On consume, the blob is fetched and verified against the checksum before the message is emitted.
+type ClaimCheckMarshaler struct {
+	Marshaler Marshaler
+	BlobStore BlobStore
+
+	// Events with data up to Threshold bytes are stored inline.
+	Threshold int
+	// Metadata key claim-checked events are marked with. Defaults to DefaultClaimCheckKey.
+	ClaimCheckKey string
+}
+
+func (c ClaimCheckMarshaler) claimCheckKey() string {
+	if c.ClaimCheckKey == "" {
+		return DefaultClaimCheckKey
+	}
+
+	return c.ClaimCheckKey
+}
+
+func (c ClaimCheckMarshaler) Marshal(msg *message.Message) (esdb.EventData, error) {
+	eventData, err := c.Marshaler.Marshal(msg)
+	if err != nil {
+		return esdb.EventData{}, err
+	}
+
+	if len(eventData.Data) <= c.Threshold {
+		return eventData, nil
+	}
+
+	checksum := sha256.Sum256(eventData.Data)
+	claimCheck := ClaimCheck{
+		Key:    uuid.NewString(),
+		SHA256: hex.EncodeToString(checksum[:]),
+		Size:   len(eventData.Data),
+	}
+
+	if err := c.BlobStore.Put(msg.Context(), claimCheck.Key, eventData.Data); err != nil {
+		return esdb.EventData{}, fmt.Errorf("can't store claim-checked payload: %w", err)
+	}
+
+	data, err := json.Marshal(claimCheck)
+	if err != nil {
+		return esdb.EventData{}, fmt.Errorf("can't encode claim check: %w", err)
+	}
+
+	metadata, err := setEventMetadata(eventData.Metadata, map[string]string{
+		c.claimCheckKey():               "true",
+		DefaultClaimCheckContentTypeKey: contentTypeName(eventData.ContentType),
+	})
+	if err != nil {
+		return esdb.EventData{}, fmt.Errorf("can't encode claim check metadata: %w", err)
+	}
+
+	eventData.Data = data
+	eventData.ContentType = esdb.ContentTypeJson
+	eventData.Metadata = metadata
+	return eventData, nil
+}
+
+func (c ClaimCheckMarshaler) Unmarshal(event *esdb.ResolvedEvent) (*message.Message, error) {
+	if eventMetadataValue(event.Event.UserMetadata, c.claimCheckKey()) != "true" {
+		return c.Marshaler.Unmarshal(event)
+	}
+
+	var claimCheck ClaimCheck
+	if err := json.Unmarshal(event.Event.Data, &claimCheck); err != nil {
+		return nil, fmt.Errorf("can't decode claim check: %w", err)
+	}
+
+	data, err := c.BlobStore.Get(context.Background(), claimCheck.Key)
+	if err != nil {
+		return nil, fmt.Errorf("can't fetch claim-checked payload %s: %w", claimCheck.Key, err)
+	}
+
+	checksum := sha256.Sum256(data)
+	if len(data) != claimCheck.Size || hex.EncodeToString(checksum[:]) != claimCheck.SHA256 {
+		return nil, fmt.Errorf("claim-checked payload %s doesn't match its checksum", claimCheck.Key)
+	}
+
+	contentType := eventMetadataValue(event.Event.UserMetadata, DefaultClaimCheckContentTypeKey)
+	m, err := c.Marshaler.Unmarshal(withEventData(event, data, contentType))
+	if err != nil {
+		return nil, err
+	}
+
+	delete(m.Metadata, c.claimCheckKey())
+	delete(m.Metadata, DefaultClaimCheckContentTypeKey)
+	return m, nil
+}
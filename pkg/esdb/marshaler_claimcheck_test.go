@@ -0,0 +1,79 @@
+package esdb_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/EventStore/EventStore-Client-Go/v4/esdb"
+	wesdb "github.com/KirylJazzSax/watermill-eventstore/pkg/esdb"
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newClaimCheckMarshaler(t *testing.T) (wesdb.ClaimCheckMarshaler, *wesdb.FileBlobStore) {
+	blobStore, err := wesdb.NewFileBlobStore(t.TempDir())
+	require.NoError(t, err)
+
+	return wesdb.ClaimCheckMarshaler{
+		Marshaler: wesdb.DefaultMarshaler{},
+		BlobStore: blobStore,
+		Threshold: 1024,
+	}, blobStore
+}
+
+func TestClaimCheckRoundTrip(t *testing.T) {
+	marshaler, _ := newClaimCheckMarshaler(t)
+	payload := bytes.Repeat([]byte{0x01}, 4096)
+	messageToMarshal := message.NewMessage(watermill.NewUUID(), payload)
+
+	event := marshalToResolvedEvent(t, marshaler, messageToMarshal)
+	assert.Less(t, len(event.Event.Data), 1024)
+
+	var claimCheck wesdb.ClaimCheck
+	require.NoError(t, json.Unmarshal(event.Event.Data, &claimCheck))
+	assert.Equal(t, len(payload), claimCheck.Size)
+
+	m, err := marshaler.Unmarshal(event)
+	require.NoError(t, err)
+	assert.Equal(t, payload, []byte(m.Payload))
+	assert.Equal(t, messageToMarshal.UUID, m.UUID)
+	assert.Equal(t, wesdb.ContentTypeBinary, m.Metadata.Get(wesdb.DefaultContentTypeKey))
+	assert.Empty(t, m.Metadata.Get(wesdb.DefaultClaimCheckKey))
+}
+
+func TestClaimCheckBelowThreshold(t *testing.T) {
+	marshaler, _ := newClaimCheckMarshaler(t)
+	messageToMarshal := message.NewMessage(watermill.NewUUID(), []byte(`{"small":true}`))
+
+	eventData, err := marshaler.Marshal(messageToMarshal)
+	require.NoError(t, err)
+	assert.Equal(t, esdb.ContentTypeJson, eventData.ContentType)
+	assert.Equal(t, []byte(messageToMarshal.Payload), eventData.Data)
+}
+
+func TestClaimCheckChecksumMismatch(t *testing.T) {
+	marshaler, blobStore := newClaimCheckMarshaler(t)
+	messageToMarshal := message.NewMessage(watermill.NewUUID(), bytes.Repeat([]byte{0x01}, 4096))
+
+	event := marshalToResolvedEvent(t, marshaler, messageToMarshal)
+
+	var claimCheck wesdb.ClaimCheck
+	require.NoError(t, json.Unmarshal(event.Event.Data, &claimCheck))
+	require.NoError(t, blobStore.Put(context.Background(), claimCheck.Key, bytes.Repeat([]byte{0x02}, 4096)))
+
+	_, err := marshaler.Unmarshal(event)
+	assert.Error(t, err)
+}
+
+func TestFileBlobStoreRejectsPaths(t *testing.T) {
+	_, blobStore := newClaimCheckMarshaler(t)
+
+	_, err := blobStore.Get(context.Background(), "../secret")
+	assert.Error(t, err)
+	_, err = blobStore.Get(context.Background(), "missing")
+	assert.ErrorIs(t, err, wesdb.ErrBlobNotFound)
+}
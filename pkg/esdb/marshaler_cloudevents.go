@@ -0,0 +1,321 @@
+package esdb
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EventStore/EventStore-Client-Go/v4/esdb"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/google/uuid"
+)
+
+// CloudEvents context attributes are exposed in the message metadata under these keys.
+// Any other metadata key is mapped to a CloudEvents extension attribute, see CloudEventsMarshaler.
+const (
+	CloudEventsSpecVersion = "1.0"
+
+	// CloudEventsKeysExtension is the extension attribute keeping the metadata keys of renamed extension attributes,
+	// as a JSON object from the attribute name to the key.
+	CloudEventsKeysExtension = "watermillkeys"
+
+	CloudEventsSourceKey          = "ce_source"
+	CloudEventsTypeKey            = "ce_type"
+	CloudEventsSubjectKey         = "ce_subject"
+	CloudEventsTimeKey            = "ce_time"
+	CloudEventsDataContentTypeKey = "ce_datacontenttype"
+	CloudEventsDataSchemaKey      = "ce_dataschema"
+)
+
+var cloudEventsAttributes = map[string]string{
+	"source":          CloudEventsSourceKey,
+	"type":            CloudEventsTypeKey,
+	"subject":         CloudEventsSubjectKey,
+	"time":            CloudEventsTimeKey,
+	"datacontenttype": CloudEventsDataContentTypeKey,
+	"dataschema":      CloudEventsDataSchemaKey,
+}
+
+// CloudEventsMarshaler maps Watermill messages to CloudEvents 1.0.
+//
+// Messages are stored in binary mode: the message UUID becomes the event ID (and the "id" attribute),
+// "type" becomes the event type, the payload becomes the event data,
+// and the remaining context attributes with the extension attributes are stored as JSON event metadata.
+//
+// CloudEvents attribute names may only contain lowercase letters and digits, so extension attributes are named after
+// their metadata keys lowercased and stripped of other characters, with a number appended when the name is taken:
+// "_watermill_event_type" becomes "watermilleventtype". The keys of renamed attributes are kept in CloudEventsKeysExtension,
+// so Unmarshal restores them.
+//
+// Unmarshal also accepts events whose data is a structured-mode CloudEvents JSON document written by other systems.
+type CloudEventsMarshaler struct {
+	// Source used when the message has no source in its metadata.
+	Source string
+	// Type used when the message has no type in its metadata. Defaults to DefaultEventType.
+	Type string
+}
+
+func (c CloudEventsMarshaler) Marshal(msg *message.Message) (esdb.EventData, error) {
+	attributes := map[string]string{}
+	for attribute, key := range cloudEventsAttributes {
+		if value := msg.Metadata.Get(key); value != "" {
+			attributes[attribute] = value
+		}
+	}
+
+	if attributes["source"] == "" {
+		attributes["source"] = c.Source
+	}
+	if attributes["source"] == "" {
+		return esdb.EventData{}, errors.New("cloudevents source is not set")
+	}
+
+	if attributes["type"] == "" {
+		attributes["type"] = c.Type
+	}
+	if attributes["type"] == "" {
+		attributes["type"] = DefaultEventType
+	}
+
+	if attributes["time"] == "" {
+		attributes["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+	}
+
+	attributes["specversion"] = CloudEventsSpecVersion
+	attributes["id"] = msg.UUID
+
+	if err := setCloudEventsExtensions(attributes, msg.Metadata); err != nil {
+		return esdb.EventData{}, err
+	}
+
+	eventID, err := uuid.Parse(msg.UUID)
+	if err != nil {
+		eventID = uuid.New()
+	}
+
+	contentType := detectContentType(msg.Payload)
+	if dataContentType := attributes["datacontenttype"]; dataContentType != "" {
+		contentType = esdb.ContentTypeBinary
+		if isJSONContentType(dataContentType) {
+			contentType = esdb.ContentTypeJson
+		}
+	}
+
+	marshaledMetadata, err := json.Marshal(attributes)
+	if err != nil {
+		return esdb.EventData{}, errors.New("can't encode message metadata")
+	}
+
+	return esdb.EventData{
+		EventID:     eventID,
+		ContentType: contentType,
+		EventType:   attributes["type"],
+		Data:        msg.Payload,
+		Metadata:    marshaledMetadata,
+	}, nil
+}
+
+// setCloudEventsExtensions sets the metadata keys which aren't context attributes as extension attributes.
+func setCloudEventsExtensions(attributes map[string]string, metadata message.Metadata) error {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		if !isCloudEventsAttributeKey(key) {
+			keys = append(keys, key)
+		}
+	}
+	// Keys which are valid names are named first, so they keep their names, and the others are renamed in a stable order.
+	slices.SortFunc(keys, func(a, b string) int {
+		aValid, bValid := cloudEventsExtensionName(a) == a, cloudEventsExtensionName(b) == b
+		if aValid != bValid {
+			if aValid {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a, b)
+	})
+
+	renamed := map[string]string{}
+	for _, key := range keys {
+		base := cloudEventsExtensionName(key)
+		if base == "" {
+			base = "extension"
+		}
+
+		name := base
+		for i := 2; isReservedCloudEventsAttribute(name) || isTaken(attributes, name); i++ {
+			name = base + strconv.Itoa(i)
+		}
+
+		attributes[name] = metadata[key]
+		if name != key {
+			renamed[name] = key
+		}
+	}
+
+	if len(renamed) > 0 {
+		encoded, err := json.Marshal(renamed)
+		if err != nil {
+			return fmt.Errorf("can't encode renamed metadata keys: %w", err)
+		}
+		attributes[CloudEventsKeysExtension] = string(encoded)
+	}
+
+	return nil
+}
+
+// cloudEventsExtensionName lowercases key and strips the characters which aren't allowed in attribute names.
+func cloudEventsExtensionName(key string) string {
+	var name strings.Builder
+	for _, r := range strings.ToLower(key) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			name.WriteRune(r)
+		}
+	}
+
+	return name.String()
+}
+
+func isTaken(attributes map[string]string, name string) bool {
+	_, ok := attributes[name]
+	return ok
+}
+
+func isCloudEventsAttributeKey(key string) bool {
+	for _, attributeKey := range cloudEventsAttributes {
+		if key == attributeKey {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isReservedCloudEventsAttribute(name string) bool {
+	switch name {
+	case "specversion", "id", "data", CloudEventsKeysExtension:
+		return true
+	}
+
+	_, ok := cloudEventsAttributes[name]
+	return ok
+}
+
+func (c CloudEventsMarshaler) Unmarshal(event *esdb.ResolvedEvent) (*message.Message, error) {
+	if attributes, ok := decodeCloudEvent(event.Event.Data); ok {
+		return c.structuredMessage(attributes)
+	}
+
+	attributes, ok := decodeCloudEvent(event.Event.UserMetadata)
+	if !ok {
+		attributes = map[string]any{}
+	}
+
+	metadata := cloudEventsMetadata(attributes)
+	if metadata.Get(CloudEventsTypeKey) == "" {
+		metadata.Set(CloudEventsTypeKey, event.Event.EventType)
+	}
+	if metadata.Get(CloudEventsTimeKey) == "" && !event.Event.CreatedDate.IsZero() {
+		metadata.Set(CloudEventsTimeKey, event.Event.CreatedDate.UTC().Format(time.RFC3339Nano))
+	}
+
+	id, _ := attributes["id"].(string)
+	if id == "" {
+		id = event.Event.EventID.String()
+	}
+
+	m := message.NewMessage(id, event.Event.Data)
+	m.Metadata = metadata
+	return m, nil
+}
+
+func (c CloudEventsMarshaler) structuredMessage(attributes map[string]any) (*message.Message, error) {
+	id, _ := attributes["id"].(string)
+	if id == "" {
+		return nil, errors.New("cloudevent has no id")
+	}
+
+	var payload []byte
+	if dataBase64, ok := attributes["data_base64"].(string); ok {
+		decoded, err := base64.StdEncoding.DecodeString(dataBase64)
+		if err != nil {
+			return nil, fmt.Errorf("can't decode cloudevent data_base64: %w", err)
+		}
+		payload = decoded
+	} else if data, ok := attributes["data"]; ok {
+		dataContentType, _ := attributes["datacontenttype"].(string)
+		if text, isString := data.(string); isString && !isJSONContentType(dataContentType) {
+			payload = []byte(text)
+		} else {
+			encoded, err := json.Marshal(data)
+			if err != nil {
+				return nil, fmt.Errorf("can't encode cloudevent data: %w", err)
+			}
+			payload = encoded
+		}
+	}
+	delete(attributes, "data")
+	delete(attributes, "data_base64")
+
+	m := message.NewMessage(id, payload)
+	m.Metadata = cloudEventsMetadata(attributes)
+	return m, nil
+}
+
+// decodeCloudEvent decodes data as a JSON object and reports whether it carries CloudEvents attributes.
+func decodeCloudEvent(data []byte) (map[string]any, bool) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return nil, false
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(trimmed))
+	decoder.UseNumber()
+
+	var attributes map[string]any
+	if err := decoder.Decode(&attributes); err != nil {
+		return nil, false
+	}
+
+	specVersion, _ := attributes["specversion"].(string)
+	return attributes, specVersion != ""
+}
+
+func cloudEventsMetadata(attributes map[string]any) message.Metadata {
+	renamed := map[string]string{}
+	if encoded, ok := attributes[CloudEventsKeysExtension].(string); ok {
+		_ = json.Unmarshal([]byte(encoded), &renamed)
+	}
+
+	metadata := message.Metadata{}
+	for attribute, value := range attributes {
+		switch attribute {
+		case "specversion", "id", CloudEventsKeysExtension:
+			continue
+		}
+
+		key, ok := cloudEventsAttributes[attribute]
+		if !ok {
+			key = attribute
+			if original, isRenamed := renamed[attribute]; isRenamed {
+				key = original
+			}
+		}
+		flattenMetadata(metadata, key, value)
+	}
+
+	return metadata
+}
+
+func isJSONContentType(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(strings.ToLower(mediaType))
+
+	return mediaType == ContentTypeJSON || mediaType == "text/json" || strings.HasSuffix(mediaType, "+json")
+}
@@ -0,0 +1,161 @@
+package esdb_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/EventStore/EventStore-Client-Go/v4/esdb"
+	wesdb "github.com/KirylJazzSax/watermill-eventstore/pkg/esdb"
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCloudEventsMarshal(t *testing.T) {
+	marshaler := wesdb.CloudEventsMarshaler{Source: "/orders"}
+	messageToMarshal := message.NewMessage(watermill.NewUUID(), []byte(`{"id":1}`))
+	messageToMarshal.Metadata.Set(wesdb.CloudEventsTypeKey, "com.example.order.placed")
+	messageToMarshal.Metadata.Set(wesdb.CloudEventsSubjectKey, "order-1")
+	messageToMarshal.Metadata.Set("tenant", "acme")
+
+	eventData, err := marshaler.Marshal(messageToMarshal)
+	require.NoError(t, err)
+	assert.Equal(t, messageToMarshal.UUID, eventData.EventID.String())
+	assert.Equal(t, "com.example.order.placed", eventData.EventType)
+	assert.Equal(t, esdb.ContentTypeJson, eventData.ContentType)
+
+	var attributes map[string]string
+	require.NoError(t, json.Unmarshal(eventData.Metadata, &attributes))
+	assert.Equal(t, "1.0", attributes["specversion"])
+	assert.Equal(t, messageToMarshal.UUID, attributes["id"])
+	assert.Equal(t, "/orders", attributes["source"])
+	assert.Equal(t, "order-1", attributes["subject"])
+	assert.Equal(t, "acme", attributes["tenant"])
+	assert.NotEmpty(t, attributes["time"])
+}
+
+func TestCloudEventsMarshalWithoutSource(t *testing.T) {
+	marshaler := wesdb.CloudEventsMarshaler{}
+
+	_, err := marshaler.Marshal(message.NewMessage(watermill.NewUUID(), []byte(`{}`)))
+	assert.Error(t, err)
+}
+
+func TestCloudEventsRoundTrip(t *testing.T) {
+	marshaler := wesdb.CloudEventsMarshaler{Source: "/orders", Type: "com.example.order.placed"}
+	messageToMarshal := message.NewMessage(watermill.NewUUID(), []byte{0x01, 0x02})
+	messageToMarshal.Metadata.Set(wesdb.CloudEventsDataContentTypeKey, "application/protobuf")
+	messageToMarshal.Metadata.Set("tenant", "acme")
+
+	eventData, err := marshaler.Marshal(messageToMarshal)
+	require.NoError(t, err)
+	assert.Equal(t, esdb.ContentTypeBinary, eventData.ContentType)
+
+	m, err := marshaler.Unmarshal(&esdb.ResolvedEvent{
+		Event: &esdb.RecordedEvent{
+			EventID:      eventData.EventID,
+			EventType:    eventData.EventType,
+			UserMetadata: eventData.Metadata,
+			Data:         eventData.Data,
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, messageToMarshal.UUID, m.UUID)
+	assert.Equal(t, []byte{0x01, 0x02}, []byte(m.Payload))
+	assert.Equal(t, "/orders", m.Metadata.Get(wesdb.CloudEventsSourceKey))
+	assert.Equal(t, "com.example.order.placed", m.Metadata.Get(wesdb.CloudEventsTypeKey))
+	assert.Equal(t, "application/protobuf", m.Metadata.Get(wesdb.CloudEventsDataContentTypeKey))
+	assert.Equal(t, "acme", m.Metadata.Get("tenant"))
+}
+
+func TestCloudEventsExtensionNames(t *testing.T) {
+	marshaler := wesdb.CloudEventsMarshaler{Source: "/orders"}
+	messageToMarshal := message.NewMessage(watermill.NewUUID(), []byte(`{}`))
+	metadata := map[string]string{
+		wesdb.DefaultEventTypeKey: "order_placed",
+		"causation_id":            "cause",
+		"tenant":                  "acme",
+		"Tenant":                  "other",
+		"source":                  "not the source",
+		"$correlationId":          "correlation",
+		"__":                      "nameless",
+	}
+	for key, value := range metadata {
+		messageToMarshal.Metadata.Set(key, value)
+	}
+
+	eventData, err := marshaler.Marshal(messageToMarshal)
+	require.NoError(t, err)
+
+	var attributes map[string]string
+	require.NoError(t, json.Unmarshal(eventData.Metadata, &attributes))
+	for name := range attributes {
+		assert.Regexp(t, `^[a-z0-9]+$`, name)
+	}
+	assert.Equal(t, "order_placed", attributes["watermilleventtype"])
+	assert.Equal(t, "acme", attributes["tenant"], "valid names are kept")
+	assert.Equal(t, "other", attributes["tenant2"])
+	assert.Equal(t, "/orders", attributes["source"], "extensions don't override context attributes")
+
+	m, err := marshaler.Unmarshal(&esdb.ResolvedEvent{
+		Event: &esdb.RecordedEvent{
+			EventID:      eventData.EventID,
+			EventType:    eventData.EventType,
+			UserMetadata: eventData.Metadata,
+			Data:         eventData.Data,
+		},
+	})
+	require.NoError(t, err)
+	for key, value := range metadata {
+		assert.Equal(t, value, m.Metadata.Get(key), "metadata key %s is restored", key)
+	}
+	assert.Empty(t, m.Metadata.Get(wesdb.CloudEventsKeysExtension))
+}
+
+func TestCloudEventsUnmarshalStructured(t *testing.T) {
+	marshaler := wesdb.CloudEventsMarshaler{}
+	structured := []byte(`{
+		"specversion": "1.0",
+		"id": "A234-1234-1234",
+		"source": "https://github.com/cloudevents/spec/pull",
+		"type": "com.github.pull_request.opened",
+		"subject": "123",
+		"time": "2018-04-05T17:31:00Z",
+		"datacontenttype": "application/json",
+		"comexampleextension1": "value",
+		"comexampleothervalue": 5,
+		"data": {"number": 123}
+	}`)
+
+	m, err := marshaler.Unmarshal(&esdb.ResolvedEvent{
+		Event: &esdb.RecordedEvent{
+			EventID:   uuid.New(),
+			EventType: "com.github.pull_request.opened",
+			Data:      structured,
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "A234-1234-1234", m.UUID)
+	assert.JSONEq(t, `{"number": 123}`, string(m.Payload))
+	assert.Equal(t, "https://github.com/cloudevents/spec/pull", m.Metadata.Get(wesdb.CloudEventsSourceKey))
+	assert.Equal(t, "123", m.Metadata.Get(wesdb.CloudEventsSubjectKey))
+	assert.Equal(t, "2018-04-05T17:31:00Z", m.Metadata.Get(wesdb.CloudEventsTimeKey))
+	assert.Equal(t, "value", m.Metadata.Get("comexampleextension1"))
+	assert.Equal(t, "5", m.Metadata.Get("comexampleothervalue"))
+}
+
+func TestCloudEventsUnmarshalStructuredBase64(t *testing.T) {
+	marshaler := wesdb.CloudEventsMarshaler{}
+	structured := []byte(`{"specversion":"1.0","id":"1","source":"/s","type":"t","data_base64":"AQI="}`)
+
+	m, err := marshaler.Unmarshal(&esdb.ResolvedEvent{
+		Event: &esdb.RecordedEvent{
+			EventID: uuid.New(),
+			Data:    structured,
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x01, 0x02}, []byte(m.Payload))
+}
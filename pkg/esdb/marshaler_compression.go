@@ -0,0 +1,169 @@
+package esdb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/EventStore/EventStore-Client-Go/v4/esdb"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/klauspost/compress/zstd"
+)
+
+// The codec of a compressed event and the content type of its uncompressed data are recorded in the event metadata.
+const (
+	DefaultCompressionCodecKey       = "_watermill_compression"
+	DefaultCompressionContentTypeKey = "_watermill_compression_content_type"
+)
+
+type CompressionCodec string
+
+const (
+	CompressionGzip CompressionCodec = "gzip"
+	CompressionZstd CompressionCodec = "zstd"
+)
+
+// CompressingMarshaler decorates a Marshaler and compresses event data larger than Threshold.
+//
+// Compressed events are stored as binary, since their data is no longer JSON,
+// and the codec is recorded in the event metadata, so Unmarshal decompresses them transparently.
+// Events without a codec in their metadata are passed to the decorated Marshaler as they are,
+// so streams written before compression was enabled stay readable.
+type CompressingMarshaler struct {
+	Marshaler Marshaler
+
+	// Codec used to compress new events. Defaults to CompressionGzip.
+	Codec CompressionCodec
+	// Events with data up to Threshold bytes are stored uncompressed.
+	Threshold int
+	// Metadata key the codec is recorded under. Defaults to DefaultCompressionCodecKey.
+	CodecKey string
+}
+
+func (c CompressingMarshaler) codec() CompressionCodec {
+	if c.Codec == "" {
+		return CompressionGzip
+	}
+
+	return c.Codec
+}
+
+func (c CompressingMarshaler) codecKey() string {
+	if c.CodecKey == "" {
+		return DefaultCompressionCodecKey
+	}
+
+	return c.CodecKey
+}
+
+func (c CompressingMarshaler) Marshal(msg *message.Message) (esdb.EventData, error) {
+	eventData, err := c.Marshaler.Marshal(msg)
+	if err != nil {
+		return esdb.EventData{}, err
+	}
+
+	if len(eventData.Data) <= c.Threshold {
+		return eventData, nil
+	}
+
+	compressed, err := compress(c.codec(), eventData.Data)
+	if err != nil {
+		return esdb.EventData{}, err
+	}
+
+	metadata, err := setEventMetadata(eventData.Metadata, map[string]string{
+		c.codecKey():                     string(c.codec()),
+		DefaultCompressionContentTypeKey: contentTypeName(eventData.ContentType),
+	})
+	if err != nil {
+		return esdb.EventData{}, fmt.Errorf("can't encode compression metadata: %w", err)
+	}
+
+	eventData.Data = compressed
+	eventData.ContentType = esdb.ContentTypeBinary
+	eventData.Metadata = metadata
+	return eventData, nil
+}
+
+func (c CompressingMarshaler) Unmarshal(event *esdb.ResolvedEvent) (*message.Message, error) {
+	codec := CompressionCodec(eventMetadataValue(event.Event.UserMetadata, c.codecKey()))
+	if codec == "" {
+		return c.Marshaler.Unmarshal(event)
+	}
+
+	data, err := decompress(codec, event.Event.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	contentType := eventMetadataValue(event.Event.UserMetadata, DefaultCompressionContentTypeKey)
+	m, err := c.Marshaler.Unmarshal(withEventData(event, data, contentType))
+	if err != nil {
+		return nil, err
+	}
+
+	delete(m.Metadata, c.codecKey())
+	delete(m.Metadata, DefaultCompressionContentTypeKey)
+	return m, nil
+}
+
+func compress(codec CompressionCodec, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	switch codec {
+	case CompressionGzip:
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, fmt.Errorf("can't compress event data: %w", err)
+		}
+		if err := w.Close(); err != nil {
+			return nil, fmt.Errorf("can't compress event data: %w", err)
+		}
+	case CompressionZstd:
+		w, err := zstd.NewWriter(&buf)
+		if err != nil {
+			return nil, fmt.Errorf("can't compress event data: %w", err)
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, fmt.Errorf("can't compress event data: %w", err)
+		}
+		if err := w.Close(); err != nil {
+			return nil, fmt.Errorf("can't compress event data: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown compression codec %s", codec)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func decompress(codec CompressionCodec, data []byte) ([]byte, error) {
+	var r io.Reader
+
+	switch codec {
+	case CompressionGzip:
+		gr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("can't decompress event data: %w", err)
+		}
+		defer gr.Close()
+		r = gr
+	case CompressionZstd:
+		zr, err := zstd.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("can't decompress event data: %w", err)
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		return nil, fmt.Errorf("unknown compression codec %s", codec)
+	}
+
+	decompressed, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("can't decompress event data: %w", err)
+	}
+
+	return decompressed, nil
+}
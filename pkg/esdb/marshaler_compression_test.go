@@ -0,0 +1,65 @@
+package esdb_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/EventStore/EventStore-Client-Go/v4/esdb"
+	wesdb "github.com/KirylJazzSax/watermill-eventstore/pkg/esdb"
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressionRoundTrip(t *testing.T) {
+	payload := []byte(`{"items":"` + string(bytes.Repeat([]byte("a"), 4096)) + `"}`)
+
+	for _, codec := range []wesdb.CompressionCodec{wesdb.CompressionGzip, wesdb.CompressionZstd} {
+		t.Run(string(codec), func(t *testing.T) {
+			marshaler := wesdb.CompressingMarshaler{
+				Marshaler: wesdb.DefaultMarshaler{},
+				Codec:     codec,
+				Threshold: 1024,
+			}
+			messageToMarshal := message.NewMessage(watermill.NewUUID(), payload)
+			messageToMarshal.Metadata.Set("key", "value")
+
+			eventData, err := marshaler.Marshal(messageToMarshal)
+			require.NoError(t, err)
+			assert.Equal(t, esdb.ContentTypeBinary, eventData.ContentType)
+			assert.Less(t, len(eventData.Data), len(payload))
+
+			m, err := marshaler.Unmarshal(marshalToResolvedEvent(t, marshaler, messageToMarshal))
+			require.NoError(t, err)
+			assert.Equal(t, payload, []byte(m.Payload))
+			assert.Equal(t, messageToMarshal.UUID, m.UUID)
+			assert.Equal(t, "value", m.Metadata.Get("key"))
+			assert.Equal(t, wesdb.ContentTypeJSON, m.Metadata.Get(wesdb.DefaultContentTypeKey))
+			assert.Empty(t, m.Metadata.Get(wesdb.DefaultCompressionCodecKey))
+		})
+	}
+}
+
+func TestCompressionBelowThreshold(t *testing.T) {
+	marshaler := wesdb.CompressingMarshaler{
+		Marshaler: wesdb.DefaultMarshaler{},
+		Threshold: 1024,
+	}
+	messageToMarshal := message.NewMessage(watermill.NewUUID(), []byte(`{"small":true}`))
+
+	eventData, err := marshaler.Marshal(messageToMarshal)
+	require.NoError(t, err)
+	assert.Equal(t, esdb.ContentTypeJson, eventData.ContentType)
+	assert.Equal(t, []byte(messageToMarshal.Payload), eventData.Data)
+}
+
+func TestCompressionReadsUncompressedEvents(t *testing.T) {
+	messageToMarshal := message.NewMessage(watermill.NewUUID(), []byte(`{"legacy":true}`))
+	event := marshalToResolvedEvent(t, wesdb.DefaultMarshaler{}, messageToMarshal)
+
+	marshaler := wesdb.CompressingMarshaler{Marshaler: wesdb.DefaultMarshaler{}}
+	m, err := marshaler.Unmarshal(event)
+	require.NoError(t, err)
+	assert.Equal(t, []byte(messageToMarshal.Payload), []byte(m.Payload))
+}
@@ -0,0 +1,175 @@
+package esdb
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"github.com/EventStore/EventStore-Client-Go/v4/esdb"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// The subject of a message is taken from DefaultEncryptionSubjectKey,
+// and the ID of the data key its payload was encrypted with is recorded in the event metadata.
+// Messages whose data key was deleted are marked with DefaultRedactedKey.
+const (
+	DefaultEncryptionSubjectKey     = "_watermill_subject_id"
+	DefaultEncryptionKeyIDKey       = "_watermill_encryption_key_id"
+	DefaultEncryptionContentTypeKey = "_watermill_encryption_content_type"
+	DefaultRedactedKey              = "_watermill_redacted"
+)
+
+// EncryptingMarshaler decorates a Marshaler and encrypts payloads with per-subject data keys (AES-256-GCM),
+// so personal data can be erased from immutable streams by deleting the subject's keys (crypto-shredding).
+//
+// Messages without a subject ID are stored unencrypted.
+// Events whose data key no longer exists are unmarshaled as redacted messages: their payload is empty
+// and DefaultRedactedKey is set in their metadata, so the subscription isn't failed by them.
+type EncryptingMarshaler struct {
+	Marshaler Marshaler
+	KeyStore  KeyStore
+
+	// Metadata key the subject ID is taken from. Defaults to DefaultEncryptionSubjectKey.
+	SubjectKey string
+	// Metadata key the data key ID is recorded under. Defaults to DefaultEncryptionKeyIDKey.
+	KeyIDKey string
+}
+
+func (e EncryptingMarshaler) subjectKey() string {
+	if e.SubjectKey == "" {
+		return DefaultEncryptionSubjectKey
+	}
+
+	return e.SubjectKey
+}
+
+func (e EncryptingMarshaler) keyIDKey() string {
+	if e.KeyIDKey == "" {
+		return DefaultEncryptionKeyIDKey
+	}
+
+	return e.KeyIDKey
+}
+
+// IsRedacted reports whether msg was unmarshaled from an event whose data key was deleted.
+func IsRedacted(msg *message.Message) bool {
+	return msg.Metadata.Get(DefaultRedactedKey) == "true"
+}
+
+func (e EncryptingMarshaler) Marshal(msg *message.Message) (esdb.EventData, error) {
+	eventData, err := e.Marshaler.Marshal(msg)
+	if err != nil {
+		return esdb.EventData{}, err
+	}
+
+	subjectID := msg.Metadata.Get(e.subjectKey())
+	if subjectID == "" {
+		return eventData, nil
+	}
+
+	keyID, key, err := e.KeyStore.DataKey(msg.Context(), subjectID)
+	if err != nil {
+		return esdb.EventData{}, fmt.Errorf("can't get data key: %w", err)
+	}
+
+	encrypted, err := encrypt(key, eventData.Data)
+	if err != nil {
+		return esdb.EventData{}, err
+	}
+
+	metadata, err := setEventMetadata(eventData.Metadata, map[string]string{
+		e.keyIDKey():                    keyID,
+		DefaultEncryptionContentTypeKey: contentTypeName(eventData.ContentType),
+	})
+	if err != nil {
+		return esdb.EventData{}, fmt.Errorf("can't encode encryption metadata: %w", err)
+	}
+
+	eventData.Data = encrypted
+	eventData.ContentType = esdb.ContentTypeBinary
+	eventData.Metadata = metadata
+	return eventData, nil
+}
+
+func (e EncryptingMarshaler) Unmarshal(event *esdb.ResolvedEvent) (*message.Message, error) {
+	keyID := eventMetadataValue(event.Event.UserMetadata, e.keyIDKey())
+	if keyID == "" {
+		return e.Marshaler.Unmarshal(event)
+	}
+
+	contentType := eventMetadataValue(event.Event.UserMetadata, DefaultEncryptionContentTypeKey)
+
+	redacted := false
+	key, err := e.KeyStore.Key(context.Background(), keyID)
+	if errors.Is(err, ErrKeyNotFound) {
+		redacted = true
+	} else if err != nil {
+		return nil, fmt.Errorf("can't get data key %s: %w", keyID, err)
+	}
+
+	var data []byte
+	if !redacted {
+		data, err = decrypt(key, event.Event.Data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	m, err := e.Marshaler.Unmarshal(withEventData(event, data, contentType))
+	if err != nil {
+		return nil, err
+	}
+
+	delete(m.Metadata, e.keyIDKey())
+	delete(m.Metadata, DefaultEncryptionContentTypeKey)
+	if redacted {
+		m.Metadata.Set(DefaultRedactedKey, "true")
+	}
+
+	return m, nil
+}
+
+func encrypt(key []byte, data []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("can't generate nonce: %w", err)
+	}
+
+	return gcm.Seal(nonce, nonce, data, nil), nil
+}
+
+func decrypt(key []byte, data []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("encrypted event data is too short")
+	}
+
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	decrypted, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("can't decrypt event data: %w", err)
+	}
+
+	return decrypted, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data key: %w", err)
+	}
+
+	return cipher.NewGCM(block)
+}
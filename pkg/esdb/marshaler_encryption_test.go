@@ -0,0 +1,80 @@
+package esdb_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/EventStore/EventStore-Client-Go/v4/esdb"
+	wesdb "github.com/KirylJazzSax/watermill-eventstore/pkg/esdb"
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptionRoundTrip(t *testing.T) {
+	fileKeyStore, err := wesdb.NewFileKeyStore(t.TempDir())
+	require.NoError(t, err)
+
+	keyStores := map[string]wesdb.KeyStore{
+		"memory": wesdb.NewMemoryKeyStore(),
+		"file":   fileKeyStore,
+	}
+
+	for name, keyStore := range keyStores {
+		t.Run(name, func(t *testing.T) {
+			marshaler := wesdb.EncryptingMarshaler{
+				Marshaler: wesdb.DefaultMarshaler{},
+				KeyStore:  keyStore,
+			}
+			messageToMarshal := message.NewMessage(watermill.NewUUID(), []byte(`{"email":"john@example.com"}`))
+			messageToMarshal.Metadata.Set(wesdb.DefaultEncryptionSubjectKey, "user-1")
+
+			event := marshalToResolvedEvent(t, marshaler, messageToMarshal)
+			assert.Equal(t, wesdb.ContentTypeBinary, event.Event.ContentType)
+			assert.NotContains(t, string(event.Event.Data), "john@example.com")
+
+			m, err := marshaler.Unmarshal(event)
+			require.NoError(t, err)
+			assert.Equal(t, []byte(messageToMarshal.Payload), []byte(m.Payload))
+			assert.Equal(t, wesdb.ContentTypeJSON, m.Metadata.Get(wesdb.DefaultContentTypeKey))
+			assert.False(t, wesdb.IsRedacted(m))
+
+			require.NoError(t, keyStore.DeleteSubject(context.Background(), "user-1"))
+
+			m, err = marshaler.Unmarshal(event)
+			require.NoError(t, err)
+			assert.True(t, wesdb.IsRedacted(m))
+			assert.Empty(t, m.Payload)
+			assert.Equal(t, messageToMarshal.UUID, m.UUID)
+		})
+	}
+}
+
+func TestEncryptionWithoutSubject(t *testing.T) {
+	marshaler := wesdb.EncryptingMarshaler{
+		Marshaler: wesdb.DefaultMarshaler{},
+		KeyStore:  wesdb.NewMemoryKeyStore(),
+	}
+	messageToMarshal := message.NewMessage(watermill.NewUUID(), []byte(`{"public":true}`))
+
+	eventData, err := marshaler.Marshal(messageToMarshal)
+	require.NoError(t, err)
+	assert.Equal(t, esdb.ContentTypeJson, eventData.ContentType)
+	assert.Equal(t, []byte(messageToMarshal.Payload), eventData.Data)
+}
+
+func TestEncryptionKeyPerSubject(t *testing.T) {
+	keyStore := wesdb.NewMemoryKeyStore()
+	ctx := context.Background()
+
+	firstKeyID, _, err := keyStore.DataKey(ctx, "user-1")
+	require.NoError(t, err)
+	sameKeyID, _, err := keyStore.DataKey(ctx, "user-1")
+	require.NoError(t, err)
+	otherKeyID, _, err := keyStore.DataKey(ctx, "user-2")
+	require.NoError(t, err)
+
+	assert.Equal(t, firstKeyID, sameKeyID)
+	assert.NotEqual(t, firstKeyID, otherKeyID)
+}
@@ -0,0 +1,109 @@
+package esdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+
+	"github.com/EventStore/EventStore-Client-Go/v4/esdb"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// Metadata key the user metadata is stored under when it isn't a JSON object.
+const DefaultRawMetadataKey = "_esdb_raw_metadata"
+
+// InteropMarshaler is a tolerant marshaler for streams shared with producers that don't use Watermill.
+// It marshals messages the same way as DefaultMarshaler, but it never fails to unmarshal an event because of its metadata:
+//
+// - empty metadata results in a message without metadata,
+//
+// - nested objects and arrays are flattened into dot-separated keys ("user.address.city", "tags.0"),
+//
+// - numbers, booleans and nulls are stringified,
+//
+// - metadata that isn't a JSON object is kept as is under RawMetadataKey.
+//
+// When the metadata has no message UUID, the EventStoreDB event ID is used,
+// and the EventStoreDB event type is set under the event type key.
+// The stored content type is exposed under the content type key as with DefaultMarshaler.
+type InteropMarshaler struct {
+	DefaultMarshaler
+
+	// Metadata key the user metadata is stored under when it isn't a JSON object.
+	RawMetadataKey string
+}
+
+func (i InteropMarshaler) rawMetadataKey() string {
+	if i.RawMetadataKey == "" {
+		return DefaultRawMetadataKey
+	}
+
+	return i.RawMetadataKey
+}
+
+func (i InteropMarshaler) Unmarshal(event *esdb.ResolvedEvent) (*message.Message, error) {
+	metadata := i.decodeMetadata(event.Event.UserMetadata)
+	restoreEventStoreIDs(metadata)
+
+	uuid := metadata.Get(i.messageUUIDHeaderKey())
+	if uuid == "" {
+		uuid = event.Event.EventID.String()
+	}
+
+	if metadata.Get(i.eventTypeKey()) == "" && event.Event.EventType != "" {
+		metadata.Set(i.eventTypeKey(), event.Event.EventType)
+	}
+
+	if event.Event.ContentType != "" {
+		metadata.Set(i.contentTypeKey(), event.Event.ContentType)
+	}
+
+	m := message.NewMessage(uuid, event.Event.Data)
+	m.Metadata = metadata
+	return m, nil
+}
+
+func (i InteropMarshaler) decodeMetadata(userMetadata []byte) message.Metadata {
+	metadata := message.Metadata{}
+
+	trimmed := bytes.TrimSpace(userMetadata)
+	if len(trimmed) == 0 {
+		return metadata
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(trimmed))
+	decoder.UseNumber()
+
+	var decoded map[string]any
+	if err := decoder.Decode(&decoded); err != nil || decoder.More() {
+		metadata.Set(i.rawMetadataKey(), string(userMetadata))
+		return metadata
+	}
+
+	for key, value := range decoded {
+		flattenMetadata(metadata, key, value)
+	}
+
+	return metadata
+}
+
+func flattenMetadata(metadata message.Metadata, key string, value any) {
+	switch v := value.(type) {
+	case map[string]any:
+		for nestedKey, nestedValue := range v {
+			flattenMetadata(metadata, key+"."+nestedKey, nestedValue)
+		}
+	case []any:
+		for index, nestedValue := range v {
+			flattenMetadata(metadata, key+"."+strconv.Itoa(index), nestedValue)
+		}
+	case string:
+		metadata.Set(key, v)
+	case json.Number:
+		metadata.Set(key, v.String())
+	case bool:
+		metadata.Set(key, strconv.FormatBool(v))
+	case nil:
+		metadata.Set(key, "")
+	}
+}
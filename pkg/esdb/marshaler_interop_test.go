@@ -0,0 +1,83 @@
+package esdb_test
+
+import (
+	"testing"
+
+	"github.com/EventStore/EventStore-Client-Go/v4/esdb"
+	wesdb "github.com/KirylJazzSax/watermill-eventstore/pkg/esdb"
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInteropUnmarshalEmptyMetadata(t *testing.T) {
+	marshaler := wesdb.InteropMarshaler{}
+	eventID := uuid.New()
+
+	m, err := marshaler.Unmarshal(&esdb.ResolvedEvent{
+		Event: &esdb.RecordedEvent{
+			EventID:   eventID,
+			EventType: "OrderPlaced",
+			Data:      []byte(`{"id":1}`),
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, eventID.String(), m.UUID)
+	assert.Equal(t, "OrderPlaced", m.Metadata.Get(wesdb.DefaultEventTypeKey))
+	assert.Equal(t, []byte(`{"id":1}`), []byte(m.Payload))
+}
+
+func TestInteropUnmarshalNestedMetadata(t *testing.T) {
+	marshaler := wesdb.InteropMarshaler{}
+
+	m, err := marshaler.Unmarshal(&esdb.ResolvedEvent{
+		Event: &esdb.RecordedEvent{
+			EventID:      uuid.New(),
+			EventType:    "OrderPlaced",
+			UserMetadata: []byte(`{"user":{"id":42,"roles":["admin","ops"]},"replayed":true,"tenant":"acme","trace":null}`),
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "42", m.Metadata.Get("user.id"))
+	assert.Equal(t, "admin", m.Metadata.Get("user.roles.0"))
+	assert.Equal(t, "ops", m.Metadata.Get("user.roles.1"))
+	assert.Equal(t, "true", m.Metadata.Get("replayed"))
+	assert.Equal(t, "acme", m.Metadata.Get("tenant"))
+	assert.Contains(t, m.Metadata, "trace")
+}
+
+func TestInteropUnmarshalNonObjectMetadata(t *testing.T) {
+	marshaler := wesdb.InteropMarshaler{}
+
+	m, err := marshaler.Unmarshal(&esdb.ResolvedEvent{
+		Event: &esdb.RecordedEvent{
+			EventID:      uuid.New(),
+			UserMetadata: []byte(`not json`),
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "not json", m.Metadata.Get(wesdb.DefaultRawMetadataKey))
+}
+
+func TestInteropRoundTrip(t *testing.T) {
+	marshaler := wesdb.InteropMarshaler{}
+	messageToMarshal := message.NewMessage(watermill.NewUUID(), []byte("hello"))
+	messageToMarshal.Metadata.Set("key", "value")
+
+	eventData, err := marshaler.Marshal(messageToMarshal)
+	require.NoError(t, err)
+
+	m, err := marshaler.Unmarshal(&esdb.ResolvedEvent{
+		Event: &esdb.RecordedEvent{
+			EventID:      uuid.New(),
+			EventType:    eventData.EventType,
+			UserMetadata: eventData.Metadata,
+			Data:         eventData.Data,
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, messageToMarshal.UUID, m.UUID)
+	assert.Equal(t, "value", m.Metadata.Get("key"))
+}
@@ -0,0 +1,102 @@
+package esdb
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/EventStore/EventStore-Client-Go/v4/esdb"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// ProtobufMarshaler stores protobuf encoded payloads as binary events.
+// The fully-qualified name of the protobuf message is used as the event type,
+// and the metadata is stored as JSON, so EventStoreDB tooling can still read it.
+//
+// Messages are built with NewMessage, and the typed protobuf message is obtained in handlers with Decode.
+// Unmarshal only resolves the event type, so events of unknown types fail early, and payloads are parsed once, by Decode.
+type ProtobufMarshaler struct {
+	DefaultMarshaler
+
+	// Registry used to resolve event types to protobuf message types.
+	// When nil, protoregistry.GlobalTypes is used.
+	Types protoregistry.MessageTypeResolver
+}
+
+func (p ProtobufMarshaler) types() protoregistry.MessageTypeResolver {
+	if p.Types == nil {
+		return protoregistry.GlobalTypes
+	}
+
+	return p.Types
+}
+
+func (p ProtobufMarshaler) findMessageType(eventType string) (protoreflect.MessageType, error) {
+	if eventType == "" {
+		return nil, errors.New("protobuf event type is not set")
+	}
+
+	messageType, err := p.types().FindMessageByName(protoreflect.FullName(eventType))
+	if err != nil {
+		return nil, fmt.Errorf("can't resolve protobuf event type %s: %w", eventType, err)
+	}
+
+	return messageType, nil
+}
+
+// NewMessage encodes pm and returns a message with the event type set to the protobuf message name.
+func (p ProtobufMarshaler) NewMessage(uuid string, pm proto.Message) (*message.Message, error) {
+	payload, err := proto.Marshal(pm)
+	if err != nil {
+		return nil, fmt.Errorf("can't encode protobuf message: %w", err)
+	}
+
+	m := message.NewMessage(uuid, payload)
+	m.Metadata.Set(p.eventTypeKey(), string(pm.ProtoReflect().Descriptor().FullName()))
+	return m, nil
+}
+
+// Decode returns the typed protobuf message carried by msg.
+func (p ProtobufMarshaler) Decode(msg *message.Message) (proto.Message, error) {
+	messageType, err := p.findMessageType(msg.Metadata.Get(p.eventTypeKey()))
+	if err != nil {
+		return nil, err
+	}
+
+	pm := messageType.New().Interface()
+	if err := proto.Unmarshal(msg.Payload, pm); err != nil {
+		return nil, fmt.Errorf("can't decode protobuf message: %w", err)
+	}
+
+	return pm, nil
+}
+
+func (p ProtobufMarshaler) Marshal(msg *message.Message) (esdb.EventData, error) {
+	if _, err := p.findMessageType(msg.Metadata.Get(p.eventTypeKey())); err != nil {
+		return esdb.EventData{}, err
+	}
+
+	eventData, err := p.DefaultMarshaler.Marshal(msg)
+	if err != nil {
+		return esdb.EventData{}, err
+	}
+
+	eventData.ContentType = esdb.ContentTypeBinary
+	return eventData, nil
+}
+
+func (p ProtobufMarshaler) Unmarshal(event *esdb.ResolvedEvent) (*message.Message, error) {
+	m, err := p.DefaultMarshaler.Unmarshal(event)
+	if err != nil {
+		return nil, err
+	}
+	m.Metadata.Set(p.eventTypeKey(), event.Event.EventType)
+
+	if _, err := p.findMessageType(event.Event.EventType); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
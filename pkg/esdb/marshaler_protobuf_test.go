@@ -0,0 +1,81 @@
+package esdb_test
+
+import (
+	"testing"
+
+	"github.com/EventStore/EventStore-Client-Go/v4/esdb"
+	wesdb "github.com/KirylJazzSax/watermill-eventstore/pkg/esdb"
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestProtobufRoundTrip(t *testing.T) {
+	marshaler := wesdb.ProtobufMarshaler{}
+	messageToMarshal, err := marshaler.NewMessage(watermill.NewUUID(), wrapperspb.String("hello"))
+	require.NoError(t, err)
+
+	eventData, err := marshaler.Marshal(messageToMarshal)
+	require.NoError(t, err)
+	assert.Equal(t, "google.protobuf.StringValue", eventData.EventType)
+	assert.Equal(t, esdb.ContentTypeBinary, eventData.ContentType)
+
+	unmarshaledMessage, err := marshaler.Unmarshal(&esdb.ResolvedEvent{
+		Event: &esdb.RecordedEvent{
+			EventType:    eventData.EventType,
+			ContentType:  wesdb.ContentTypeBinary,
+			UserMetadata: eventData.Metadata,
+			Data:         eventData.Data,
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, messageToMarshal.UUID, unmarshaledMessage.UUID)
+
+	decoded, err := marshaler.Decode(unmarshaledMessage)
+	require.NoError(t, err)
+	assert.True(t, proto.Equal(wrapperspb.String("hello"), decoded))
+}
+
+func TestProtobufMarshalWithoutEventType(t *testing.T) {
+	marshaler := wesdb.ProtobufMarshaler{}
+	messageToMarshal := message.NewMessage(watermill.NewUUID(), []byte("hello"))
+
+	_, err := marshaler.Marshal(messageToMarshal)
+	assert.Error(t, err)
+}
+
+func TestProtobufUnmarshalUnknownType(t *testing.T) {
+	marshaler := wesdb.ProtobufMarshaler{Types: new(protoregistry.Types)}
+	payload, err := proto.Marshal(wrapperspb.String("hello"))
+	require.NoError(t, err)
+
+	_, err = marshaler.Unmarshal(&esdb.ResolvedEvent{
+		Event: &esdb.RecordedEvent{
+			EventType:    "google.protobuf.StringValue",
+			UserMetadata: []byte(`{}`),
+			Data:         payload,
+		},
+	})
+	assert.Error(t, err)
+}
+
+func TestProtobufUnmarshalLeavesParsingToDecode(t *testing.T) {
+	marshaler := wesdb.ProtobufMarshaler{}
+
+	// The payload isn't a valid StringValue, which only Decode finds out.
+	m, err := marshaler.Unmarshal(&esdb.ResolvedEvent{
+		Event: &esdb.RecordedEvent{
+			EventType:    "google.protobuf.StringValue",
+			UserMetadata: []byte(`{}`),
+			Data:         []byte{0xff},
+		},
+	})
+	require.NoError(t, err)
+
+	_, err = marshaler.Decode(m)
+	assert.Error(t, err)
+}
@@ -14,13 +14,41 @@ import (
 
 func TestMarshal(t *testing.T) {
 	marshaler := wesdb.DefaultMarshaler{}
-	messageToMarshal := message.NewMessage(watermill.NewUUID(), []byte("hello"))
+	messageToMarshal := message.NewMessage(watermill.NewUUID(), []byte(`{"hello":"world"}`))
 
 	eventData, err := marshaler.Marshal(messageToMarshal)
 	require.NoError(t, err)
 	assert.Equal(t, esdb.ContentTypeJson, eventData.ContentType)
 }
 
+func TestMarshalBinary(t *testing.T) {
+	marshaler := wesdb.DefaultMarshaler{}
+	messageToMarshal := message.NewMessage(watermill.NewUUID(), []byte{0x0a, 0x05, 'h', 'e', 'l', 'l', 'o'})
+
+	eventData, err := marshaler.Marshal(messageToMarshal)
+	require.NoError(t, err)
+	assert.Equal(t, esdb.ContentTypeBinary, eventData.ContentType)
+}
+
+func TestMarshalContentTypeFromMetadata(t *testing.T) {
+	marshaler := wesdb.NewDefaultMarshaler(wesdb.WithContentType(esdb.ContentTypeJson))
+	messageToMarshal := message.NewMessage(watermill.NewUUID(), []byte(`{"hello":"world"}`))
+	messageToMarshal.Metadata.Set(wesdb.DefaultContentTypeKey, "application/x-protobuf")
+
+	eventData, err := marshaler.Marshal(messageToMarshal)
+	require.NoError(t, err)
+	assert.Equal(t, esdb.ContentTypeBinary, eventData.ContentType)
+}
+
+func TestMarshalConfiguredContentType(t *testing.T) {
+	marshaler := wesdb.NewDefaultMarshaler(wesdb.WithContentType(esdb.ContentTypeBinary))
+	messageToMarshal := message.NewMessage(watermill.NewUUID(), []byte(`{"hello":"world"}`))
+
+	eventData, err := marshaler.Marshal(messageToMarshal)
+	require.NoError(t, err)
+	assert.Equal(t, esdb.ContentTypeBinary, eventData.ContentType)
+}
+
 func TestDefaultEventType(t *testing.T) {
 	marshaler := wesdb.DefaultMarshaler{}
 	messageToMarshal := message.NewMessage(watermill.NewUUID(), []byte("hello"))
@@ -66,6 +94,7 @@ func TestUnmarshal(t *testing.T) {
 
 	resolvedEvent := &esdb.ResolvedEvent{
 		Event: &esdb.RecordedEvent{
+			ContentType:  wesdb.ContentTypeJSON,
 			UserMetadata: eventData.Metadata,
 			Data:         marshaledData,
 		},
@@ -73,6 +102,7 @@ func TestUnmarshal(t *testing.T) {
 
 	unmarshaledMessage, err := marshaler.Unmarshal(resolvedEvent)
 	require.NoError(t, err)
+	assert.Equal(t, wesdb.ContentTypeJSON, unmarshaledMessage.Metadata.Get(wesdb.DefaultContentTypeKey))
 	var unmarshaledBody struct {
 		Field string
 	}
@@ -81,3 +111,41 @@ func TestUnmarshal(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, data, unmarshaledBody)
 }
+
+func TestCustomKeys(t *testing.T) {
+	marshaler := wesdb.NewDefaultMarshaler(
+		wesdb.WithMessageUUIDHeaderKey("message-id"),
+		wesdb.WithEventTypeKey("type"),
+		wesdb.WithEventType("fallback_event"),
+	)
+	messageToMarshal := message.NewMessage(watermill.NewUUID(), []byte("hello"))
+	messageToMarshal.Metadata.Set("type", "custom_event")
+
+	eventData, err := marshaler.Marshal(messageToMarshal)
+	require.NoError(t, err)
+	assert.Equal(t, "custom_event", eventData.EventType)
+
+	var metadata message.Metadata
+	err = json.Unmarshal(eventData.Metadata, &metadata)
+	require.NoError(t, err)
+	assert.Equal(t, messageToMarshal.UUID, metadata.Get("message-id"))
+	assert.Empty(t, metadata.Get(wesdb.DefaultMessageUUIDHeaderKey))
+
+	unmarshaledMessage, err := marshaler.Unmarshal(&esdb.ResolvedEvent{
+		Event: &esdb.RecordedEvent{
+			UserMetadata: eventData.Metadata,
+			Data:         eventData.Data,
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, messageToMarshal.UUID, unmarshaledMessage.UUID)
+}
+
+func TestCustomFallbackEventType(t *testing.T) {
+	marshaler := wesdb.NewDefaultMarshaler(wesdb.WithEventType("fallback_event"))
+	messageToMarshal := message.NewMessage(watermill.NewUUID(), []byte("hello"))
+
+	eventData, err := marshaler.Marshal(messageToMarshal)
+	require.NoError(t, err)
+	assert.Equal(t, "fallback_event", eventData.EventType)
+}
@@ -0,0 +1,239 @@
+package esdb
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const metricsNamespace = "watermill_esdb"
+
+// Metrics collects Prometheus metrics of publishers and subscribers.
+// A nil *Metrics is valid and collects nothing, so metrics are optional.
+type Metrics struct {
+	appends           *prometheus.CounterVec
+	appendDuration    *prometheus.HistogramVec
+	appendFailures    *prometheus.CounterVec
+	batchSize         *prometheus.HistogramVec
+	delivered         *prometheus.CounterVec
+	acked             *prometheus.CounterVec
+	nacked            *prometheus.CounterVec
+	unmarshalFailures *prometheus.CounterVec
+	inFlight          *prometheus.GaugeVec
+	handlerDuration   *prometheus.HistogramVec
+	lag               *prometheus.GaugeVec
+	parked            *prometheus.GaugeVec
+	resubscriptions   *prometheus.CounterVec
+}
+
+// NewMetrics creates the metrics and registers them with registerer.
+func NewMetrics(registerer prometheus.Registerer) (*Metrics, error) {
+	subscriberLabels := []string{"topic", "subscription_group"}
+
+	m := &Metrics{
+		appends: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "publisher",
+			Name:      "appends_total",
+			Help:      "Number of events appended to streams.",
+		}, []string{"topic"}),
+		appendDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "publisher",
+			Name:      "append_duration_seconds",
+			Help:      "Duration of appending events to a stream.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"topic"}),
+		appendFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "publisher",
+			Name:      "append_failures_total",
+			Help:      "Number of messages that couldn't be appended, by error class.",
+		}, []string{"topic", "error_class"}),
+		batchSize: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "publisher",
+			Name:      "batch_size",
+			Help:      "Number of messages passed to a single Publish call.",
+			Buckets:   prometheus.ExponentialBuckets(1, 2, 10),
+		}, []string{"topic"}),
+		delivered: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "subscriber",
+			Name:      "delivered_total",
+			Help:      "Number of messages delivered to handlers.",
+		}, subscriberLabels),
+		acked: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "subscriber",
+			Name:      "acked_total",
+			Help:      "Number of messages acked by handlers.",
+		}, subscriberLabels),
+		nacked: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "subscriber",
+			Name:      "nacked_total",
+			Help:      "Number of messages nacked by handlers.",
+		}, subscriberLabels),
+		unmarshalFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "subscriber",
+			Name:      "unmarshal_failures_total",
+			Help:      "Number of events that couldn't be unmarshaled.",
+		}, subscriberLabels),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "subscriber",
+			Name:      "in_flight_messages",
+			Help:      "Number of messages delivered to handlers and not acked yet.",
+		}, subscriberLabels),
+		handlerDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "subscriber",
+			Name:      "handler_duration_seconds",
+			Help:      "Duration from delivering a message to a handler until it's acked or abandoned.",
+			Buckets:   prometheus.DefBuckets,
+		}, subscriberLabels),
+		lag: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "subscriber",
+			Name:      "lag_events",
+			Help:      "Number of events of the stream not handled by the subscription yet.",
+		}, subscriberLabels),
+		parked: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "subscriber",
+			Name:      "parked_messages",
+			Help:      "Number of events the server parked after the persistent subscription ran out of retries.",
+		}, subscriberLabels),
+		resubscriptions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "subscriber",
+			Name:      "resubscriptions_total",
+			Help:      "Number of times dropped subscriptions were resubscribed.",
+		}, subscriberLabels),
+	}
+
+	collectors := []prometheus.Collector{
+		m.appends,
+		m.appendDuration,
+		m.appendFailures,
+		m.batchSize,
+		m.delivered,
+		m.acked,
+		m.nacked,
+		m.unmarshalFailures,
+		m.inFlight,
+		m.handlerDuration,
+		m.lag,
+		m.parked,
+		m.resubscriptions,
+	}
+	for _, collector := range collectors {
+		if err := registerer.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+func (m *Metrics) published(topic string, batchSize int) {
+	if m == nil {
+		return
+	}
+
+	m.batchSize.WithLabelValues(topic).Observe(float64(batchSize))
+}
+
+func (m *Metrics) appended(topic string, events int, duration time.Duration, err error) {
+	if m == nil {
+		return
+	}
+
+	m.appendDuration.WithLabelValues(topic).Observe(duration.Seconds())
+	if err != nil {
+		m.appendFailed(topic, ClassifyError(err))
+		return
+	}
+	m.appends.WithLabelValues(topic).Add(float64(events))
+}
+
+func (m *Metrics) appendFailed(topic string, class ErrorClass) {
+	if m == nil {
+		return
+	}
+
+	m.appendFailures.WithLabelValues(topic, string(class)).Inc()
+}
+
+func (m *Metrics) messageDelivered(topic, group string) {
+	if m == nil {
+		return
+	}
+
+	m.delivered.WithLabelValues(topic, group).Inc()
+	m.inFlight.WithLabelValues(topic, group).Inc()
+}
+
+func (m *Metrics) messageHandled(topic, group string, acked bool, duration time.Duration) {
+	if m == nil {
+		return
+	}
+
+	m.inFlight.WithLabelValues(topic, group).Dec()
+	m.handlerDuration.WithLabelValues(topic, group).Observe(duration.Seconds())
+	if acked {
+		m.acked.WithLabelValues(topic, group).Inc()
+	}
+}
+
+func (m *Metrics) messageNacked(topic, group string) {
+	if m == nil {
+		return
+	}
+
+	m.nacked.WithLabelValues(topic, group).Inc()
+}
+
+func (m *Metrics) unmarshalFailed(topic, group string) {
+	if m == nil {
+		return
+	}
+
+	m.unmarshalFailures.WithLabelValues(topic, group).Inc()
+}
+
+func (m *Metrics) lagMeasured(topic, group string, lag uint64) {
+	if m == nil {
+		return
+	}
+
+	m.lag.WithLabelValues(topic, group).Set(float64(lag))
+}
+
+func (m *Metrics) parkedMeasured(topic, group string, parked int64) {
+	if m == nil {
+		return
+	}
+
+	m.parked.WithLabelValues(topic, group).Set(float64(parked))
+}
+
+// lagRemoved removes the gauges measured with the lag, once no subscription to topic measures them.
+func (m *Metrics) lagRemoved(topic, group string) {
+	if m == nil {
+		return
+	}
+
+	m.lag.DeleteLabelValues(topic, group)
+	m.parked.DeleteLabelValues(topic, group)
+}
+
+func (m *Metrics) resubscribed(topic, group string) {
+	if m == nil {
+		return
+	}
+
+	m.resubscriptions.WithLabelValues(topic, group).Inc()
+}
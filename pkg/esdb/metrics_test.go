@@ -0,0 +1,75 @@
+package esdb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	metrics, err := NewMetrics(registry)
+	require.NoError(t, err)
+
+	metrics.published("orders", 3)
+	metrics.appended("orders", 2, time.Millisecond, nil)
+	metrics.appended("orders", 1, time.Millisecond, status.Error(codes.Unavailable, "unavailable"))
+	metrics.appendFailed("orders", ErrorClassMarshal)
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(metrics.appends.WithLabelValues("orders")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.appendFailures.WithLabelValues("orders", string(ErrorClassUnavailable))))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.appendFailures.WithLabelValues("orders", string(ErrorClassMarshal))))
+
+	metrics.messageDelivered("orders", "group")
+	metrics.messageDelivered("orders", "group")
+	assert.Equal(t, 2.0, testutil.ToFloat64(metrics.inFlight.WithLabelValues("orders", "group")))
+
+	metrics.messageNacked("orders", "group")
+	metrics.messageHandled("orders", "group", true, time.Millisecond)
+	metrics.messageHandled("orders", "group", false, time.Millisecond)
+	metrics.unmarshalFailed("orders", "group")
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(metrics.delivered.WithLabelValues("orders", "group")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.acked.WithLabelValues("orders", "group")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.nacked.WithLabelValues("orders", "group")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.unmarshalFailures.WithLabelValues("orders", "group")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(metrics.inFlight.WithLabelValues("orders", "group")))
+
+	metrics.lagMeasured("orders", "group", 12)
+	assert.Equal(t, 12.0, testutil.ToFloat64(metrics.lag.WithLabelValues("orders", "group")))
+	metrics.parkedMeasured("orders", "group", 3)
+	assert.Equal(t, 3.0, testutil.ToFloat64(metrics.parked.WithLabelValues("orders", "group")))
+
+	metrics.lagRemoved("orders", "group")
+	assert.Equal(t, 0, testutil.CollectAndCount(metrics.lag))
+	assert.Equal(t, 0, testutil.CollectAndCount(metrics.parked))
+
+	metrics.resubscribed("orders", "group")
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.resubscriptions.WithLabelValues("orders", "group")))
+
+	_, err = NewMetrics(registry)
+	assert.Error(t, err, "metrics can't be registered twice")
+}
+
+func TestNilMetrics(t *testing.T) {
+	var metrics *Metrics
+
+	assert.NotPanics(t, func() {
+		metrics.published("orders", 1)
+		metrics.appended("orders", 1, time.Millisecond, nil)
+		metrics.messageDelivered("orders", "")
+		metrics.messageHandled("orders", "", true, time.Millisecond)
+		metrics.messageNacked("orders", "")
+		metrics.unmarshalFailed("orders", "")
+		metrics.lagMeasured("orders", "", 1)
+		metrics.parkedMeasured("orders", "", 1)
+		metrics.lagRemoved("orders", "")
+		metrics.resubscribed("orders", "")
+	})
+}
@@ -0,0 +1,187 @@
+package esdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/EventStore/EventStore-Client-Go/v4/esdb"
+)
+
+// readEvent reads the first event of stream from position in direction.
+// It returns nil when there is no such event or the stream doesn't exist.
+func readEvent(
+	ctx context.Context,
+	reader streamReader,
+	stream string,
+	direction esdb.Direction,
+	from esdb.StreamPosition,
+	credentials *esdb.Credentials,
+) (*esdb.RecordedEvent, error) {
+	read, err := reader.ReadStream(ctx, stream, esdb.ReadStreamOptions{
+		Direction:     direction,
+		From:          from,
+		Authenticated: credentials,
+	}, 1)
+	if IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't read stream: %w", err)
+	}
+	defer read.Close()
+
+	event, err := read.Recv()
+	if errors.Is(err, io.EOF) || IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't read stream: %w", err)
+	}
+
+	return event.OriginalEvent(), nil
+}
+
+// revisionAt returns the revision of the first event of stream created at or after t.
+// When every event was created before t, it's the revision after the last one, which is 0 for empty streams.
+//
+// Events of a stream are created in order of their revisions, so the revision is found by a binary search,
+// reading a single event per step. Revisions missing because of truncation or $maxCount are skipped.
+func revisionAt(
+	ctx context.Context,
+	reader streamReader,
+	stream string,
+	t time.Time,
+	credentials *esdb.Credentials,
+) (uint64, error) {
+	last, err := readEvent(ctx, reader, stream, esdb.Backwards, esdb.End{}, credentials)
+	if err != nil {
+		return 0, err
+	}
+	if last == nil {
+		return 0, nil
+	}
+	if last.CreatedDate.Before(t) {
+		return last.EventNumber + 1, nil
+	}
+
+	// Search for the first revision in [low, high) of an event created at or after t.
+	low, high := uint64(0), last.EventNumber
+	for low < high {
+		middle := low + (high-low)/2
+
+		event, err := readEvent(ctx, reader, stream, esdb.Forwards, esdb.Revision(middle), credentials)
+		if err != nil {
+			return 0, err
+		}
+		if event == nil || !event.CreatedDate.Before(t) {
+			high = middle
+		} else {
+			low = event.EventNumber + 1
+		}
+	}
+
+	return low, nil
+}
+
+// positionAt returns the position to subscribe to stream from, so the first event delivered is the first one created at or after t.
+// When every event was created before t, only events appended from now on are delivered.
+func positionAt(
+	ctx context.Context,
+	reader streamReader,
+	stream string,
+	t time.Time,
+	credentials *esdb.Credentials,
+) (esdb.StreamPosition, error) {
+	revision, err := revisionAt(ctx, reader, stream, t, credentials)
+	if err != nil {
+		return nil, err
+	}
+
+	// Subscriptions start after the given revision.
+	if revision == 0 {
+		return esdb.Start{}, nil
+	}
+	return esdb.Revision(revision - 1), nil
+}
+
+// allPositionAt returns the position to subscribe to $all from, so the first event delivered is the first one created at or after t.
+//
+// Positions of $all aren't contiguous, so they can't be searched like revisions. Instead, $all is read backwards
+// in pages of pageSize events until the first event created before t, so only the events which will be replayed are read.
+func allPositionAt(
+	ctx context.Context,
+	client readerClient,
+	t time.Time,
+	credentials *esdb.Credentials,
+	pageSize uint64,
+) (esdb.AllPosition, error) {
+	var (
+		from         esdb.AllPosition = esdb.End{}
+		lastPosition *esdb.Position
+	)
+	for {
+		count := pageSize
+		// Pages start with the last event of the previous page.
+		if lastPosition != nil {
+			count++
+		}
+
+		events, err := readPage(ctx, func() (readStream, error) {
+			return client.ReadAll(ctx, esdb.ReadAllOptions{
+				Direction:     esdb.Backwards,
+				From:          from,
+				Authenticated: credentials,
+			}, count)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("can't read $all: %w", err)
+		}
+
+		for _, event := range events {
+			recorded := event.OriginalEvent()
+			if lastPosition != nil && recorded.Position == *lastPosition {
+				continue
+			}
+			if recorded.CreatedDate.Before(t) {
+				// Subscriptions start after the given position.
+				return recorded.Position, nil
+			}
+		}
+
+		if uint64(len(events)) < count {
+			return esdb.Start{}, nil
+		}
+
+		position := events[len(events)-1].OriginalEvent().Position
+		lastPosition = &position
+		from = position
+	}
+}
+
+// PositionAt returns the position to subscribe to topic from, so the first event delivered is the first one created at or after t.
+// It's used for catch-up subscriptions when SubscriberConfig.FromTime is set.
+// Subscriber only subscribes to streams; for subscriptions to $all see Reader.AllPositionAt.
+func (s *Subscriber) PositionAt(ctx context.Context, topic string, t time.Time) (esdb.StreamPosition, error) {
+	return positionAt(ctx, s.client, topic, t, s.config.Subscriber.SubscribeToStreamOptions.Authenticated)
+}
+
+// PositionAt returns the position to read stream from with ReadOptions.From, so the first event read is the first one created at or after t.
+// When every event was created before t, it's the revision after the last event, so nothing is read from it.
+// Subscriptions start after their position, so use Subscriber.PositionAt for them instead.
+func (r *Reader) PositionAt(ctx context.Context, stream string, t time.Time, credentials *esdb.Credentials) (esdb.StreamPosition, error) {
+	revision, err := revisionAt(ctx, r.client, stream, t, credentials)
+	if err != nil {
+		return nil, err
+	}
+
+	return esdb.Revision(revision), nil
+}
+
+// AllPositionAt returns the position to subscribe to $all from, so the first event delivered is the first one created at or after t.
+// It's esdb.Start{} when every event was created at or after t.
+func (r *Reader) AllPositionAt(ctx context.Context, t time.Time, credentials *esdb.Credentials) (esdb.AllPosition, error) {
+	return allPositionAt(ctx, r.client, t, credentials, DefaultReadPageSize)
+}
@@ -0,0 +1,170 @@
+package esdb
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/EventStore/EventStore-Client-Go/v4/esdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPositionAt(t *testing.T) {
+	start := time.Date(2024, 5, 1, 14, 0, 0, 0, time.UTC)
+
+	backend := &memoryBackend{}
+	// Revisions 0-99 are created a minute apart, revisions 20-29 were truncated.
+	for revision := uint64(0); revision < 100; revision++ {
+		if revision >= 20 && revision < 30 {
+			continue
+		}
+		backend.appendToStream("orders", &esdb.RecordedEvent{
+			EventNumber: revision,
+			CreatedDate: start.Add(time.Duration(revision) * time.Minute),
+		})
+	}
+
+	testCases := []struct {
+		name     string
+		time     time.Time
+		expected esdb.StreamPosition
+	}{
+		{name: "before first event", time: start.Add(-time.Hour), expected: esdb.Start{}},
+		{name: "at first event", time: start, expected: esdb.Start{}},
+		{name: "at event", time: start.Add(50 * time.Minute), expected: esdb.Revision(49)},
+		{name: "between events", time: start.Add(50*time.Minute + time.Second), expected: esdb.Revision(50)},
+		// Revision 30 is the first one after 19.
+		{name: "in truncated revisions", time: start.Add(25 * time.Minute), expected: esdb.Revision(19)},
+		{name: "at last event", time: start.Add(99 * time.Minute), expected: esdb.Revision(98)},
+		{name: "after last event", time: start.Add(time.Hour * 2), expected: esdb.Revision(99)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			position, err := positionAt(context.Background(), backend, "orders", tc.time, nil)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, position)
+		})
+	}
+
+	backend.reads = 0
+	_, err := positionAt(context.Background(), backend, "orders", start.Add(50*time.Minute), nil)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, backend.reads, 9, "revision is found by a binary search")
+}
+
+func TestReaderPositionAt(t *testing.T) {
+	start := time.Date(2024, 5, 1, 14, 0, 0, 0, time.UTC)
+
+	reader, backend := newTestReader(t, nil)
+	for revision := uint64(0); revision < 10; revision++ {
+		backend.appendToStream("orders", newTestRecordedEvent(t, "orders-"+strconv.FormatUint(revision, 10), revision))
+		backend.streams["orders"][revision].CreatedDate = start.Add(time.Duration(revision) * time.Minute)
+	}
+
+	testCases := []struct {
+		name     string
+		time     time.Time
+		expected []string
+	}{
+		{name: "before first event", time: start.Add(-time.Hour), expected: []string{"orders-0", "orders-1", "orders-2"}},
+		{name: "at event", time: start.Add(5 * time.Minute), expected: []string{"orders-5", "orders-6", "orders-7"}},
+		{name: "between events", time: start.Add(5*time.Minute + time.Second), expected: []string{"orders-6", "orders-7", "orders-8"}},
+		{name: "at last event", time: start.Add(9 * time.Minute), expected: []string{"orders-9"}},
+		{name: "after last event", time: start.Add(time.Hour)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			from, err := reader.PositionAt(context.Background(), "orders", tc.time, nil)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, uuids(t, reader.Read(context.Background(), "orders", ReadOptions{From: from, MaxCount: 3})))
+		})
+	}
+
+	from, err := reader.PositionAt(context.Background(), "payments", start, nil)
+	require.NoError(t, err)
+	assert.Empty(t, uuids(t, reader.Read(context.Background(), "payments", ReadOptions{From: from})), "nothing is read from empty streams")
+}
+
+func TestAllPositionAt(t *testing.T) {
+	start := time.Date(2024, 5, 1, 14, 0, 0, 0, time.UTC)
+
+	backend := &memoryBackend{}
+	// Events of both streams are created a minute apart, alternating between the streams.
+	for i := 0; i < 100; i++ {
+		stream := "orders"
+		if i%2 == 1 {
+			stream = "payments"
+		}
+		backend.appendToStream(stream, &esdb.RecordedEvent{
+			EventNumber: uint64(i / 2),
+			CreatedDate: start.Add(time.Duration(i) * time.Minute),
+		})
+	}
+	position := func(i uint64) esdb.Position {
+		return esdb.Position{Commit: i, Prepare: i}
+	}
+
+	testCases := []struct {
+		name     string
+		time     time.Time
+		expected esdb.AllPosition
+	}{
+		{name: "before first event", time: start.Add(-time.Hour), expected: esdb.Start{}},
+		{name: "at first event", time: start, expected: esdb.Start{}},
+		{name: "at event", time: start.Add(50 * time.Minute), expected: position(49)},
+		{name: "between events", time: start.Add(50*time.Minute + time.Second), expected: position(50)},
+		{name: "after last event", time: start.Add(2 * time.Hour), expected: position(99)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			position, err := allPositionAt(context.Background(), backend, tc.time, nil, 7)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, position)
+		})
+	}
+
+	backend.reads = 0
+	_, err := allPositionAt(context.Background(), backend, start.Add(90*time.Minute), nil, 7)
+	require.NoError(t, err)
+	assert.Equal(t, 2, backend.reads, "only events created since t are read")
+}
+
+func TestAllPositionAtEmpty(t *testing.T) {
+	position, err := allPositionAt(context.Background(), &memoryBackend{}, time.Now(), nil, 7)
+	require.NoError(t, err)
+	assert.Equal(t, esdb.Start{}, position)
+}
+
+func TestPositionAtEmptyStream(t *testing.T) {
+	position, err := positionAt(context.Background(), &memoryBackend{}, "orders", time.Now(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, esdb.Start{}, position)
+}
+
+func TestSubscribeFromTime(t *testing.T) {
+	start := time.Date(2024, 5, 1, 14, 0, 0, 0, time.UTC)
+
+	backend := &memoryBackend{}
+	for revision := uint64(0); revision < 10; revision++ {
+		backend.appendToStream("orders", &esdb.RecordedEvent{
+			EventNumber: revision,
+			CreatedDate: start.Add(time.Duration(revision) * time.Minute),
+		})
+	}
+
+	subscriber := newTestSubscriber(backend, SubscriberConfig{
+		SubscribeToStreamOptions: esdb.SubscribeToStreamOptions{From: esdb.End{}},
+		FromTime:                 start.Add(5 * time.Minute),
+	})
+	_, err := subscriber.Subscribe(context.Background(), "orders")
+	require.NoError(t, err)
+
+	assert.Equal(t, esdb.Revision(4), backend.subscribeOptions(0).From)
+
+	closeWithin(t, subscriber, time.Second)
+}
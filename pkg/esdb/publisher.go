@@ -4,15 +4,19 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/EventStore/EventStore-Client-Go/v4/esdb"
 	"github.com/ThreeDotsLabs/watermill"
 	"github.com/ThreeDotsLabs/watermill/message"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Publisher struct {
-	client *esdb.Client
+	client publisherClient
 	config Config
+	tracer tracer
+	health *healthTracker
 }
 
 func NewPublisher(config Config, logger watermill.LoggerAdapter) (*Publisher, error) {
@@ -25,33 +29,123 @@ func NewPublisher(config Config, logger watermill.LoggerAdapter) (*Publisher, er
 	}
 
 	return &Publisher{
-		client: db,
+		client: esdbClient{db},
 		config: config,
+		tracer: newTracer(config.Tracing),
+		health: newHealthTracker(),
 	}, nil
 }
 
 func (p *Publisher) Publish(stream string, messages ...*message.Message) (err error) {
+	p.config.Metrics.published(stream, len(messages))
+
 	for _, m := range messages {
-		eventData, err := p.config.Marshaler.Marshal(m)
+		_, err := p.appendMessages(context.WithoutCancel(m.Context()), stream, p.config.Publisher.Options, m)
 		if err != nil {
-			return errors.New("couldn't marshal message")
+			return err
 		}
+	}
+
+	return nil
+}
+
+// Append appends messages to stream in a single write, if the stream is at expectedRevision.
+// It returns the revision of the last appended event.
+//
+// When the stream is at a different revision, nothing is appended and the error wraps ErrWrongExpectedVersion.
+func (p *Publisher) Append(
+	ctx context.Context,
+	stream string,
+	expectedRevision esdb.ExpectedRevision,
+	messages ...*message.Message,
+) (uint64, error) {
+	p.config.Metrics.published(stream, len(messages))
 
-		_, err = p.client.AppendToStream(
-			context.Background(),
-			stream,
-			p.config.Publisher.Options,
-			eventData,
-		)
+	options := p.config.Publisher.Options
+	options.ExpectedRevision = expectedRevision
+	return p.appendMessages(ctx, stream, options, messages...)
+}
 
+// appendMessages marshals messages and appends them to stream in a single write, with a span per message.
+func (p *Publisher) appendMessages(
+	ctx context.Context,
+	stream string,
+	options esdb.AppendToStreamOptions,
+	messages ...*message.Message,
+) (revision uint64, err error) {
+	spans := make([]trace.Span, 0, len(messages))
+	defer func() {
+		for _, span := range spans {
+			endSpan(span, err)
+		}
+	}()
+
+	events := make([]esdb.EventData, 0, len(messages))
+	for _, m := range messages {
+		_, span, traced := p.tracer.startPublish(stream, m)
+		spans = append(spans, span)
+
+		eventData, err := p.config.Marshaler.Marshal(traced)
 		if err != nil {
-			return fmt.Errorf("could not publish message %s", err)
+			p.config.Metrics.appendFailed(stream, ErrorClassMarshal)
+			return 0, fmt.Errorf("couldn't marshal message: %w", err)
 		}
+		span.SetAttributes(EventTypeAttribute.String(eventData.EventType))
+		events = append(events, eventData)
+	}
+
+	start := time.Now()
+	result, err := p.client.AppendToStream(ctx, stream, options, events...)
+	p.config.Metrics.appended(stream, len(events), time.Since(start), err)
+
+	if err != nil {
+		p.health.setLastError(err)
+		if IsWrongExpectedVersion(err) && !errors.Is(err, ErrWrongExpectedVersion) {
+			err = fmt.Errorf("%w: %w", ErrWrongExpectedVersion, err)
+		}
+		return 0, fmt.Errorf("could not publish message (%s): %w", ClassifyError(err), err)
+	}
+
+	// Events are appended with consecutive revisions, ending with the next expected one.
+	for i, span := range spans {
+		eventRevision := result.NextExpectedVersion - uint64(len(spans)-1-i)
+		span.SetAttributes(RevisionAttribute.Int64(int64(eventRevision)))
+	}
+
+	return result.NextExpectedVersion, nil
+}
+
+// SetStreamMetadata sets the metadata of stream, for example its $maxCount.
+// It uses the credentials and deadline of Publisher.Options, but not their expected revision, which is meant for events.
+func (p *Publisher) SetStreamMetadata(ctx context.Context, stream string, metadata esdb.StreamMetadata) error {
+	options := p.config.Publisher.Options
+	options.ExpectedRevision = nil
+
+	if _, err := p.client.SetStreamMetadata(ctx, stream, options, metadata); err != nil {
+		p.health.setLastError(err)
+		return fmt.Errorf("could not set metadata of %s (%s): %w", stream, ClassifyError(err), err)
 	}
 
 	return nil
 }
 
+// StreamMetadata returns the metadata of stream, which is empty when it was never set.
+// It uses the credentials of Publisher.Options.
+func (p *Publisher) StreamMetadata(ctx context.Context, stream string) (esdb.StreamMetadata, error) {
+	metadata, err := p.client.GetStreamMetadata(ctx, stream, esdb.ReadStreamOptions{
+		Authenticated: p.config.Publisher.Options.Authenticated,
+	})
+	if IsNotFound(err) {
+		return esdb.StreamMetadata{}, nil
+	}
+	if err != nil {
+		p.health.setLastError(err)
+		return esdb.StreamMetadata{}, fmt.Errorf("could not get metadata of %s (%s): %w", stream, ClassifyError(err), err)
+	}
+
+	return *metadata, nil
+}
+
 func (p *Publisher) Close() error {
 	return p.client.Close()
 }
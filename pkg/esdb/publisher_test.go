@@ -0,0 +1,98 @@
+package esdb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/EventStore/EventStore-Client-Go/v4/esdb"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestPublisher(backend *memoryBackend) *Publisher {
+	return &Publisher{
+		client: backend,
+		config: Config{Marshaler: DefaultMarshaler{}},
+		tracer: newTracer(TracingConfig{}),
+		health: newHealthTracker(),
+	}
+}
+
+func TestPublisherAppend(t *testing.T) {
+	backend := &memoryBackend{}
+	publisher := newTestPublisher(backend)
+
+	revision, err := publisher.Append(
+		context.Background(),
+		"order-1",
+		esdb.NoStream{},
+		message.NewMessage("1", []byte(`{}`)),
+		message.NewMessage("2", []byte(`{}`)),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), revision)
+
+	revision, err = publisher.Append(context.Background(), "order-1", esdb.Revision(1), message.NewMessage("3", []byte(`{}`)))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), revision)
+
+	require.Len(t, backend.streams["order-1"], 3)
+	for i, uuid := range []string{"1", "2", "3"} {
+		m, err := DefaultMarshaler{}.Unmarshal(&esdb.ResolvedEvent{Event: backend.streams["order-1"][i]})
+		require.NoError(t, err)
+		assert.Equal(t, uuid, m.UUID)
+	}
+}
+
+func TestPublisherAppendWrongExpectedVersion(t *testing.T) {
+	backend := &memoryBackend{}
+	publisher := newTestPublisher(backend)
+
+	_, err := publisher.Append(context.Background(), "order-1", esdb.NoStream{}, message.NewMessage("1", []byte(`{}`)))
+	require.NoError(t, err)
+
+	_, err = publisher.Append(
+		context.Background(),
+		"order-1",
+		esdb.NoStream{},
+		message.NewMessage("2", []byte(`{}`)),
+		message.NewMessage("3", []byte(`{}`)),
+	)
+	assert.ErrorIs(t, err, ErrWrongExpectedVersion)
+	assert.True(t, IsWrongExpectedVersion(err))
+	assert.Len(t, backend.streams["order-1"], 1, "nothing is appended")
+}
+
+func TestPublishUsesConfiguredOptions(t *testing.T) {
+	backend := &memoryBackend{}
+	publisher := newTestPublisher(backend)
+	publisher.config.Publisher.Options.ExpectedRevision = esdb.NoStream{}
+
+	require.NoError(t, publisher.Publish("orders", message.NewMessage("1", []byte(`{}`))))
+	assert.ErrorIs(t, publisher.Publish("orders", message.NewMessage("2", []byte(`{}`))), ErrWrongExpectedVersion)
+}
+
+func TestPublisherSetStreamMetadata(t *testing.T) {
+	backend := &memoryBackend{}
+	publisher := newTestPublisher(backend)
+	credentials := &esdb.Credentials{Login: "admin", Password: "changeit"}
+	publisher.config.Publisher.Options = esdb.AppendToStreamOptions{
+		ExpectedRevision: esdb.NoStream{},
+		Authenticated:    credentials,
+	}
+
+	metadata := esdb.StreamMetadata{}
+	metadata.SetMaxCount(1)
+	require.NoError(t, publisher.SetStreamMetadata(context.Background(), "snapshot-order-1", metadata))
+
+	stored, err := publisher.StreamMetadata(context.Background(), "snapshot-order-1")
+	require.NoError(t, err)
+	assert.Equal(t, metadata, stored)
+
+	maxCount := stored.MaxCount()
+	require.NotNil(t, maxCount)
+	assert.Equal(t, uint64(1), *maxCount)
+	assert.Equal(t, credentials, backend.metadataOptions.Authenticated)
+	assert.Nil(t, backend.metadataOptions.ExpectedRevision)
+}
@@ -0,0 +1,334 @@
+package esdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"strconv"
+	"strings"
+
+	"github.com/EventStore/EventStore-Client-Go/v4/esdb"
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// Metadata keys of the origin of messages read by Reader.
+const (
+	// StreamKey is the metadata key of the stream the message was read from.
+	StreamKey = "_esdb_stream"
+	// RevisionKey is the metadata key of the stream revision of the message.
+	RevisionKey = "_esdb_revision"
+	// CommitPositionKey is the metadata key of the commit position of the message in $all.
+	CommitPositionKey = "_esdb_commit_position"
+	// PreparePositionKey is the metadata key of the prepare position of the message in $all.
+	PreparePositionKey = "_esdb_prepare_position"
+)
+
+// DefaultReadPageSize is the number of events read per request when ReadOptions.PageSize isn't set.
+const DefaultReadPageSize = 500
+
+// Reader reads streams once, from a position to a position or the current end, and finishes.
+// It's meant for backfills, exports and loading aggregates, unlike Subscriber which keeps delivering new events.
+//
+// Messages are unmarshaled with Config.Marshaler and carry their stream under StreamKey, their stream revision under RevisionKey
+// and their position in $all under CommitPositionKey and PreparePositionKey. They don't have to be acked.
+type Reader struct {
+	client readerClient
+	config Config
+	logger watermill.LoggerAdapter
+}
+
+func NewReader(config Config, logger watermill.LoggerAdapter) (*Reader, error) {
+	client, err := newClient(config.ConnectionString, logger)
+	if err != nil {
+		logger.Error("conldn't connect to client", err, watermill.LogFields{
+			"connectionString": config.ConnectionString,
+		})
+		return nil, errors.New("conldn't connect to client")
+	}
+
+	return &Reader{
+		client: esdbClient{client},
+		config: config,
+		logger: logger,
+	}, nil
+}
+
+type ReadOptions struct {
+	// Direction of reading. Defaults to esdb.Forwards.
+	Direction esdb.Direction
+	// Position to read from, inclusive. Defaults to esdb.Start{} when reading forwards and esdb.End{} when reading backwards.
+	From esdb.StreamPosition
+	// Revision to read to, inclusive. When nil, the stream is read to its end, or its start when reading backwards.
+	To *uint64
+	// Number of events read per request. Defaults to DefaultReadPageSize.
+	PageSize uint64
+	// Maximum number of messages to read. When zero, all of them are read.
+	MaxCount uint64
+
+	ResolveLinkTos bool
+	Authenticated  *esdb.Credentials
+}
+
+func (o ReadOptions) pageSize() uint64 {
+	if o.PageSize == 0 {
+		return DefaultReadPageSize
+	}
+
+	return o.PageSize
+}
+
+// nextCount returns the number of events to request when read messages were read already.
+func (o ReadOptions) nextCount(read uint64) uint64 {
+	count := o.pageSize()
+	if o.MaxCount > 0 && o.MaxCount-read < count {
+		count = o.MaxCount - read
+	}
+
+	return count
+}
+
+type ReadAllOptions struct {
+	// Direction of reading. Defaults to esdb.Forwards.
+	Direction esdb.Direction
+	// Position to read from. Defaults to esdb.Start{} when reading forwards and esdb.End{} when reading backwards.
+	From esdb.AllPosition
+	// Number of events read per request. Defaults to DefaultReadPageSize.
+	PageSize uint64
+	// Maximum number of messages to read. When zero, all of them are read.
+	MaxCount uint64
+
+	ResolveLinkTos bool
+	Authenticated  *esdb.Credentials
+}
+
+// Read reads the messages of stream.
+// The sequence ends at the end of the range, or after yielding an error.
+func (r *Reader) Read(ctx context.Context, stream string, options ReadOptions) iter.Seq2[*message.Message, error] {
+	return func(yield func(*message.Message, error) bool) {
+		from := options.From
+		if from == nil {
+			from = esdb.Start{}
+			if options.Direction == esdb.Backwards {
+				from = esdb.End{}
+			}
+		}
+
+		var read uint64
+		for {
+			count := options.nextCount(read)
+			if count == 0 {
+				return
+			}
+
+			events, err := readPage(ctx, func() (readStream, error) {
+				return r.client.ReadStream(ctx, stream, esdb.ReadStreamOptions{
+					Direction:      options.Direction,
+					From:           from,
+					ResolveLinkTos: options.ResolveLinkTos,
+					Authenticated:  options.Authenticated,
+				}, count)
+			})
+			if err != nil {
+				yield(nil, fmt.Errorf("can't read stream %s: %w", stream, err))
+				return
+			}
+
+			for _, event := range events {
+				revision := event.OriginalEvent().EventNumber
+				if options.To != nil && pastRevision(options.Direction, revision, *options.To) {
+					return
+				}
+
+				m, err := r.config.Marshaler.Unmarshal(event)
+				if err != nil {
+					yield(nil, fmt.Errorf("can't unmarshal event %d of %s: %w", revision, stream, err))
+					return
+				}
+				setOrigin(m, event.OriginalEvent())
+
+				read++
+				if !yield(m, nil) {
+					return
+				}
+			}
+
+			if uint64(len(events)) < count {
+				return
+			}
+
+			last := events[len(events)-1].OriginalEvent().EventNumber
+			if options.Direction == esdb.Backwards {
+				if last == 0 {
+					return
+				}
+				from = esdb.Revision(last - 1)
+			} else {
+				from = esdb.Revision(last + 1)
+			}
+		}
+	}
+}
+
+// ReadAll reads the messages of the $all stream. System events, with types starting with $, are skipped.
+// The sequence ends at the end of $all, or after yielding an error.
+func (r *Reader) ReadAll(ctx context.Context, options ReadAllOptions) iter.Seq2[*message.Message, error] {
+	return func(yield func(*message.Message, error) bool) {
+		from := options.From
+		if from == nil {
+			from = esdb.Start{}
+			if options.Direction == esdb.Backwards {
+				from = esdb.End{}
+			}
+		}
+
+		readOptions := ReadOptions{PageSize: options.PageSize, MaxCount: options.MaxCount}
+		var (
+			read         uint64
+			lastPosition *esdb.Position
+		)
+		for {
+			count := readOptions.nextCount(read)
+			if count == 0 {
+				return
+			}
+			// Pages start with the last event of the previous page.
+			if lastPosition != nil {
+				count++
+			}
+
+			events, err := readPage(ctx, func() (readStream, error) {
+				return r.client.ReadAll(ctx, esdb.ReadAllOptions{
+					Direction:      options.Direction,
+					From:           from,
+					ResolveLinkTos: options.ResolveLinkTos,
+					Authenticated:  options.Authenticated,
+				}, count)
+			})
+			if err != nil {
+				yield(nil, fmt.Errorf("can't read $all: %w", err))
+				return
+			}
+
+			for _, event := range events {
+				recorded := event.OriginalEvent()
+				if lastPosition != nil && recorded.Position == *lastPosition {
+					continue
+				}
+				if strings.HasPrefix(recorded.EventType, "$") {
+					continue
+				}
+
+				m, err := r.config.Marshaler.Unmarshal(event)
+				if err != nil {
+					yield(nil, fmt.Errorf("can't unmarshal event %d of %s: %w", recorded.EventNumber, recorded.StreamID, err))
+					return
+				}
+				setOrigin(m, recorded)
+
+				read++
+				if !yield(m, nil) {
+					return
+				}
+				if options.MaxCount > 0 && read >= options.MaxCount {
+					return
+				}
+			}
+
+			if uint64(len(events)) < count {
+				return
+			}
+
+			position := events[len(events)-1].OriginalEvent().Position
+			lastPosition = &position
+			from = position
+		}
+	}
+}
+
+// ReadChannel reads the messages of stream like Read, but sends them to a channel.
+// Both channels are closed when reading ends. The error channel receives at most one error.
+func (r *Reader) ReadChannel(ctx context.Context, stream string, options ReadOptions) (<-chan *message.Message, <-chan error) {
+	return readToChannel(ctx, r.Read(ctx, stream, options))
+}
+
+// ReadAllChannel reads the messages of the $all stream like ReadAll, but sends them to a channel.
+// Both channels are closed when reading ends. The error channel receives at most one error.
+func (r *Reader) ReadAllChannel(ctx context.Context, options ReadAllOptions) (<-chan *message.Message, <-chan error) {
+	return readToChannel(ctx, r.ReadAll(ctx, options))
+}
+
+func (r *Reader) Close() error {
+	return r.client.Close()
+}
+
+func readToChannel(ctx context.Context, messages iter.Seq2[*message.Message, error]) (<-chan *message.Message, <-chan error) {
+	out := make(chan *message.Message)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer func() {
+			close(out)
+			close(errs)
+		}()
+
+		for m, err := range messages {
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			select {
+			case out <- m:
+			case <-ctx.Done():
+				errs <- ctx.Err()
+				return
+			}
+		}
+	}()
+
+	return out, errs
+}
+
+// readPage reads all events returned by a single read request.
+func readPage(ctx context.Context, open func() (readStream, error)) ([]*esdb.ResolvedEvent, error) {
+	read, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer read.Close()
+
+	var events []*esdb.ResolvedEvent
+	for {
+		event, err := read.Recv()
+		if errors.Is(err, io.EOF) {
+			return events, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		events = append(events, event)
+	}
+}
+
+// setOrigin sets the stream and the positions recorded was read from to the metadata of m.
+func setOrigin(m *message.Message, recorded *esdb.RecordedEvent) {
+	m.Metadata.Set(StreamKey, recorded.StreamID)
+	m.Metadata.Set(RevisionKey, strconv.FormatUint(recorded.EventNumber, 10))
+	m.Metadata.Set(CommitPositionKey, strconv.FormatUint(recorded.Position.Commit, 10))
+	m.Metadata.Set(PreparePositionKey, strconv.FormatUint(recorded.Position.Prepare, 10))
+}
+
+func pastRevision(direction esdb.Direction, revision uint64, to uint64) bool {
+	if direction == esdb.Backwards {
+		return revision < to
+	}
+
+	return revision > to
+}
@@ -0,0 +1,201 @@
+package esdb
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/EventStore/EventStore-Client-Go/v4/esdb"
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestReader(t *testing.T, streams map[string]int) (*Reader, *memoryBackend) {
+	t.Helper()
+
+	backend := &memoryBackend{}
+	for stream, count := range streams {
+		for revision := 0; revision < count; revision++ {
+			backend.appendToStream(stream, newTestRecordedEvent(t, stream+"-"+strconv.Itoa(revision), uint64(revision)))
+		}
+	}
+
+	return &Reader{
+		client: backend,
+		config: Config{Marshaler: DefaultMarshaler{}},
+		logger: watermill.NopLogger{},
+	}, backend
+}
+
+func uuids(t *testing.T, messages func(yield func(*message.Message, error) bool)) []string {
+	t.Helper()
+
+	var result []string
+	for m, err := range messages {
+		require.NoError(t, err)
+		result = append(result, m.UUID)
+	}
+
+	return result
+}
+
+func revision(revision uint64) *uint64 {
+	return &revision
+}
+
+func TestRead(t *testing.T) {
+	reader, _ := newTestReader(t, map[string]int{"orders": 10})
+
+	testCases := []struct {
+		name     string
+		options  ReadOptions
+		expected []string
+	}{
+		{
+			name:     "forwards to end",
+			options:  ReadOptions{PageSize: 3},
+			expected: []string{"orders-0", "orders-1", "orders-2", "orders-3", "orders-4", "orders-5", "orders-6", "orders-7", "orders-8", "orders-9"},
+		},
+		{
+			name:     "forwards from revision to revision",
+			options:  ReadOptions{From: esdb.Revision(2), To: revision(5), PageSize: 2},
+			expected: []string{"orders-2", "orders-3", "orders-4", "orders-5"},
+		},
+		{
+			name:     "backwards to start",
+			options:  ReadOptions{Direction: esdb.Backwards, PageSize: 4},
+			expected: []string{"orders-9", "orders-8", "orders-7", "orders-6", "orders-5", "orders-4", "orders-3", "orders-2", "orders-1", "orders-0"},
+		},
+		{
+			name:     "backwards from revision to revision",
+			options:  ReadOptions{Direction: esdb.Backwards, From: esdb.Revision(7), To: revision(5)},
+			expected: []string{"orders-7", "orders-6", "orders-5"},
+		},
+		{
+			name:     "max count",
+			options:  ReadOptions{MaxCount: 5, PageSize: 2},
+			expected: []string{"orders-0", "orders-1", "orders-2", "orders-3", "orders-4"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, uuids(t, reader.Read(context.Background(), "orders", tc.options)))
+		})
+	}
+}
+
+func TestReadPages(t *testing.T) {
+	reader, backend := newTestReader(t, map[string]int{"orders": 10})
+
+	assert.Len(t, uuids(t, reader.Read(context.Background(), "orders", ReadOptions{PageSize: 5})), 10)
+	assert.Equal(t, 3, backend.reads, "full pages are followed by another read")
+
+	backend.reads = 0
+	for range reader.Read(context.Background(), "orders", ReadOptions{PageSize: 5}) {
+		break
+	}
+	assert.Equal(t, 1, backend.reads, "stopping the iteration stops reading")
+}
+
+func TestReadSetsRevision(t *testing.T) {
+	reader, _ := newTestReader(t, map[string]int{"orders": 3})
+
+	var revisions []string
+	for m, err := range reader.Read(context.Background(), "orders", ReadOptions{Direction: esdb.Backwards}) {
+		require.NoError(t, err)
+		assert.Equal(t, "orders", m.Metadata.Get(StreamKey))
+		revisions = append(revisions, m.Metadata.Get(RevisionKey))
+	}
+
+	assert.Equal(t, []string{"2", "1", "0"}, revisions)
+}
+
+func TestReadEmptyStream(t *testing.T) {
+	reader, _ := newTestReader(t, nil)
+
+	assert.Empty(t, uuids(t, reader.Read(context.Background(), "orders", ReadOptions{})))
+}
+
+func TestReadUnmarshalError(t *testing.T) {
+	reader, backend := newTestReader(t, map[string]int{"orders": 2})
+	backend.appendToStream("orders", &esdb.RecordedEvent{EventNumber: 2, ContentType: ContentTypeJSON})
+
+	var (
+		read []string
+		err  error
+	)
+	for m, readErr := range reader.Read(context.Background(), "orders", ReadOptions{}) {
+		if readErr != nil {
+			err = readErr
+			continue
+		}
+		read = append(read, m.UUID)
+	}
+
+	assert.Equal(t, []string{"orders-0", "orders-1"}, read)
+	assert.ErrorContains(t, err, "can't unmarshal event 2 of orders")
+}
+
+func TestReadAll(t *testing.T) {
+	reader, backend := newTestReader(t, nil)
+	for revision := 0; revision < 3; revision++ {
+		backend.appendToStream("orders", newTestRecordedEvent(t, "orders-"+strconv.Itoa(revision), uint64(revision)))
+		backend.appendToStream("$stats", &esdb.RecordedEvent{EventType: "$statsCollected", EventNumber: uint64(revision)})
+		backend.appendToStream("payments", newTestRecordedEvent(t, "payments-"+strconv.Itoa(revision), uint64(revision)))
+	}
+
+	assert.Equal(
+		t,
+		[]string{"orders-0", "payments-0", "orders-1", "payments-1", "orders-2", "payments-2"},
+		uuids(t, reader.ReadAll(context.Background(), ReadAllOptions{PageSize: 2})),
+	)
+	assert.Equal(
+		t,
+		[]string{"payments-2", "orders-2", "payments-1"},
+		uuids(t, reader.ReadAll(context.Background(), ReadAllOptions{Direction: esdb.Backwards, PageSize: 2, MaxCount: 3})),
+	)
+
+	var origins [][]string
+	for m, err := range reader.ReadAll(context.Background(), ReadAllOptions{MaxCount: 2}) {
+		require.NoError(t, err)
+		origins = append(origins, []string{
+			m.Metadata.Get(StreamKey),
+			m.Metadata.Get(RevisionKey),
+			m.Metadata.Get(CommitPositionKey),
+			m.Metadata.Get(PreparePositionKey),
+		})
+	}
+	assert.Equal(t, [][]string{
+		{"orders", "0", "0", "0"},
+		{"payments", "0", "2", "2"},
+	}, origins, "messages carry the stream and the position they were read from")
+}
+
+func TestReadChannel(t *testing.T) {
+	reader, _ := newTestReader(t, map[string]int{"orders": 3})
+
+	messages, errs := reader.ReadChannel(context.Background(), "orders", ReadOptions{PageSize: 2})
+
+	var read []string
+	for m := range messages {
+		read = append(read, m.UUID)
+	}
+	assert.Equal(t, []string{"orders-0", "orders-1", "orders-2"}, read)
+	assert.NoError(t, <-errs)
+}
+
+func TestReadChannelCanceled(t *testing.T) {
+	reader, _ := newTestReader(t, map[string]int{"orders": 3})
+	ctx, cancel := context.WithCancel(context.Background())
+
+	messages, errs := reader.ReadChannel(ctx, "orders", ReadOptions{})
+	<-messages
+	cancel()
+
+	assert.ErrorIs(t, <-errs, context.Canceled)
+	_, ok := <-messages
+	assert.False(t, ok)
+}
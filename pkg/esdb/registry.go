@@ -0,0 +1,203 @@
+package esdb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// The version of an event type is stored in the metadata next to the event type.
+// Messages without a version are treated as version 1.
+const DefaultEventVersionKey = "_watermill_event_version"
+
+type registeredEvent struct {
+	eventType string
+	version   int
+}
+
+// EventRegistry maps Go types to event types and versions.
+// Typed values are encoded as JSON payloads with NewMessage, and decoded back into their Go types with Decode.
+// The zero value is ready to use.
+type EventRegistry struct {
+	// Metadata key the event type is stored under. Defaults to DefaultEventTypeKey.
+	EventTypeKey string
+	// Metadata key the event version is stored under. Defaults to DefaultEventVersionKey.
+	EventVersionKey string
+
+	lock   sync.RWMutex
+	events map[reflect.Type]registeredEvent
+	types  map[registeredEvent]reflect.Type
+}
+
+func NewEventRegistry() *EventRegistry {
+	return &EventRegistry{
+		events: map[reflect.Type]registeredEvent{},
+		types:  map[registeredEvent]reflect.Type{},
+	}
+}
+
+func (r *EventRegistry) eventTypeKey() string {
+	if r.EventTypeKey == "" {
+		return DefaultEventTypeKey
+	}
+
+	return r.EventTypeKey
+}
+
+func (r *EventRegistry) eventVersionKey() string {
+	if r.EventVersionKey == "" {
+		return DefaultEventVersionKey
+	}
+
+	return r.EventVersionKey
+}
+
+func eventGoType(event any) reflect.Type {
+	t := reflect.TypeOf(event)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	return t
+}
+
+// Register registers the Go type of event under eventType and version.
+// Both values and pointers can be passed, they register the same type.
+func (r *EventRegistry) Register(eventType string, version int, event any) error {
+	if eventType == "" {
+		return errors.New("event type is empty")
+	}
+	if version < 1 {
+		return fmt.Errorf("invalid version %d of event type %s", version, eventType)
+	}
+
+	t := eventGoType(event)
+	if t == nil {
+		return errors.New("can't register nil event")
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.events == nil {
+		r.events = map[reflect.Type]registeredEvent{}
+		r.types = map[registeredEvent]reflect.Type{}
+	}
+
+	registered := registeredEvent{eventType, version}
+	if existing, ok := r.events[t]; ok {
+		return fmt.Errorf("type %s is already registered as %s v%d", t, existing.eventType, existing.version)
+	}
+	if existing, ok := r.types[registered]; ok {
+		return fmt.Errorf("%s v%d is already registered for type %s", eventType, version, existing)
+	}
+
+	r.events[t] = registered
+	r.types[registered] = t
+	return nil
+}
+
+// MustRegister is like Register, but panics on error.
+func (r *EventRegistry) MustRegister(eventType string, version int, event any) {
+	if err := r.Register(eventType, version, event); err != nil {
+		panic(err)
+	}
+}
+
+// EventType returns the event type and version event is registered under.
+func (r *EventRegistry) EventType(event any) (string, int, error) {
+	t := eventGoType(event)
+
+	r.lock.RLock()
+	registered, ok := r.events[t]
+	r.lock.RUnlock()
+
+	if !ok {
+		return "", 0, fmt.Errorf("type %s is not registered", t)
+	}
+
+	return registered.eventType, registered.version, nil
+}
+
+// NewMessage encodes event as JSON and returns a message with its event type and version set.
+func (r *EventRegistry) NewMessage(event any) (*message.Message, error) {
+	eventType, version, err := r.EventType(event)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("can't encode %s: %w", eventType, err)
+	}
+
+	m := message.NewMessage(watermill.NewUUID(), payload)
+	m.Metadata.Set(r.eventTypeKey(), eventType)
+	m.Metadata.Set(r.eventVersionKey(), strconv.Itoa(version))
+	return m, nil
+}
+
+// Decode decodes the payload of msg into a new value of the type registered for its event type and version.
+// The returned value is a pointer to the registered type.
+func (r *EventRegistry) Decode(msg *message.Message) (any, error) {
+	eventType := msg.Metadata.Get(r.eventTypeKey())
+	version, err := messageEventVersion(msg, r.eventVersionKey())
+	if err != nil {
+		return nil, err
+	}
+
+	r.lock.RLock()
+	t, ok := r.types[registeredEvent{eventType, version}]
+	r.lock.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%s v%d is not registered", eventType, version)
+	}
+
+	event := reflect.New(t).Interface()
+	if err := json.Unmarshal(msg.Payload, event); err != nil {
+		return nil, fmt.Errorf("can't decode %s v%d: %w", eventType, version, err)
+	}
+
+	return event, nil
+}
+
+// DecodeAs decodes msg with the registry and returns it as T.
+// T can be either the registered type or a pointer to it.
+func DecodeAs[T any](r *EventRegistry, msg *message.Message) (T, error) {
+	var zero T
+
+	event, err := r.Decode(msg)
+	if err != nil {
+		return zero, err
+	}
+
+	if typed, ok := event.(T); ok {
+		return typed, nil
+	}
+	if typed, ok := reflect.ValueOf(event).Elem().Interface().(T); ok {
+		return typed, nil
+	}
+
+	return zero, fmt.Errorf("decoded %T, not %T", event, zero)
+}
+
+func messageEventVersion(msg *message.Message, key string) (int, error) {
+	value := msg.Metadata.Get(key)
+	if value == "" {
+		return 1, nil
+	}
+
+	version, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid event version %q: %w", value, err)
+	}
+
+	return version, nil
+}
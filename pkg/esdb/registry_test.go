@@ -0,0 +1,93 @@
+package esdb_test
+
+import (
+	"testing"
+
+	wesdb "github.com/KirylJazzSax/watermill-eventstore/pkg/esdb"
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type orderPlaced struct {
+	OrderID string `json:"order_id"`
+}
+
+type orderPlacedV2 struct {
+	OrderID  string `json:"order_id"`
+	Customer string `json:"customer"`
+}
+
+func TestEventRegistryRoundTrip(t *testing.T) {
+	registry := wesdb.NewEventRegistry()
+	registry.MustRegister("order_placed", 1, orderPlaced{})
+	registry.MustRegister("order_placed", 2, &orderPlacedV2{})
+
+	m, err := registry.NewMessage(orderPlacedV2{OrderID: "1", Customer: "acme"})
+	require.NoError(t, err)
+	assert.Equal(t, "order_placed", m.Metadata.Get(wesdb.DefaultEventTypeKey))
+	assert.Equal(t, "2", m.Metadata.Get(wesdb.DefaultEventVersionKey))
+
+	decoded, err := registry.Decode(m)
+	require.NoError(t, err)
+	assert.Equal(t, &orderPlacedV2{OrderID: "1", Customer: "acme"}, decoded)
+
+	typed, err := wesdb.DecodeAs[orderPlacedV2](registry, m)
+	require.NoError(t, err)
+	assert.Equal(t, orderPlacedV2{OrderID: "1", Customer: "acme"}, typed)
+
+	_, err = wesdb.DecodeAs[orderPlaced](registry, m)
+	assert.Error(t, err)
+}
+
+func TestEventRegistryZeroValue(t *testing.T) {
+	registry := &wesdb.EventRegistry{EventTypeKey: "type"}
+
+	_, _, err := registry.EventType(orderPlaced{})
+	assert.Error(t, err, "nothing is registered yet")
+
+	require.NoError(t, registry.Register("order_placed", 1, orderPlaced{}))
+
+	m, err := registry.NewMessage(orderPlaced{OrderID: "1"})
+	require.NoError(t, err)
+	assert.Equal(t, "order_placed", m.Metadata.Get("type"))
+
+	decoded, err := registry.Decode(m)
+	require.NoError(t, err)
+	assert.Equal(t, &orderPlaced{OrderID: "1"}, decoded)
+}
+
+func TestEventRegistryDefaultVersion(t *testing.T) {
+	registry := wesdb.NewEventRegistry()
+	registry.MustRegister("order_placed", 1, orderPlaced{})
+
+	m := message.NewMessage(watermill.NewUUID(), []byte(`{"order_id":"1"}`))
+	m.Metadata.Set(wesdb.DefaultEventTypeKey, "order_placed")
+
+	typed, err := wesdb.DecodeAs[*orderPlaced](registry, m)
+	require.NoError(t, err)
+	assert.Equal(t, "1", typed.OrderID)
+}
+
+func TestEventRegistryRejectsDuplicates(t *testing.T) {
+	registry := wesdb.NewEventRegistry()
+	require.NoError(t, registry.Register("order_placed", 1, orderPlaced{}))
+
+	assert.Error(t, registry.Register("order_placed", 1, orderPlacedV2{}))
+	assert.Error(t, registry.Register("order_created", 1, &orderPlaced{}))
+	assert.Error(t, registry.Register("", 1, orderPlacedV2{}))
+	assert.Error(t, registry.Register("order_placed", 0, orderPlacedV2{}))
+}
+
+func TestEventRegistryUnknownEvents(t *testing.T) {
+	registry := wesdb.NewEventRegistry()
+
+	_, err := registry.NewMessage(orderPlaced{})
+	assert.Error(t, err)
+
+	m := message.NewMessage(watermill.NewUUID(), []byte(`{}`))
+	m.Metadata.Set(wesdb.DefaultEventTypeKey, "order_placde")
+	_, err = registry.Decode(m)
+	assert.Error(t, err)
+}
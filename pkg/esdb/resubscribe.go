@@ -0,0 +1,132 @@
+package esdb
+
+import (
+	"context"
+	"time"
+
+	"github.com/EventStore/EventStore-Client-Go/v4/esdb"
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// DefaultResubscribeDelay is the delay between resubscribe attempts when SubscriberConfig.ResubscribeDelay isn't set.
+const DefaultResubscribeDelay = time.Second
+
+func (s *Subscriber) resubscribeDelay() time.Duration {
+	if s.config.Subscriber.ResubscribeDelay == 0 {
+		return DefaultResubscribeDelay
+	}
+
+	return s.config.Subscriber.ResubscribeDelay
+}
+
+// shouldResubscribe reports whether a subscription which failed with err should be resubscribed.
+// Failed authentication and deleted streams won't get better by retrying.
+func (s *Subscriber) shouldResubscribe(err error) bool {
+	if !s.config.Subscriber.Resubscribe {
+		return false
+	}
+
+	switch ClassifyError(err) {
+	case ErrorClassAuth, ErrorClassStreamDeleted:
+		return false
+	default:
+		return true
+	}
+}
+
+// resumePosition is the last event delivered by a single catch-up subscription, which it continues after when resubscribed.
+// Each Subscribe call has its own, so other subscriptions to the same topic start from where they're configured to.
+// It's used only by the goroutine running the subscription.
+type resumePosition struct {
+	revision  uint64
+	delivered bool
+}
+
+func (p *resumePosition) setDelivered(event *esdb.ResolvedEvent) {
+	if recorded := event.OriginalEvent(); recorded != nil {
+		p.revision = recorded.EventNumber
+		p.delivered = true
+	}
+}
+
+// resubscribe opens the subscription again after it was dropped with dropErr.
+// It returns a nil consumeFunc without an error when ctx is done or the subscriber is closing in the meantime.
+func (s *Subscriber) resubscribe(ctx context.Context, key subscriptionKey, resume *resumePosition, dropErr error) (consumeFunc, error) {
+	topic := key.topic
+	s.health.setStatus(key, SubscriptionStatusReconnecting)
+	s.health.setError(key, dropErr)
+	s.logger.Info("resubscribing after subscription dropped", watermill.LogFields{
+		"topic":              topic,
+		"subscription-group": s.config.Subscriber.SubscriptionGroup,
+		"error":              dropErr,
+		"error-class":        ClassifyError(dropErr),
+	})
+
+	delay := s.resubscribeDelay()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-s.draining:
+			return nil, nil
+		case <-ctx.Done():
+			return nil, nil
+		case <-timer.C:
+		}
+
+		consume, err := s.openSubscription(ctx, key, resume)
+		if err == nil {
+			s.health.setStatus(key, SubscriptionStatusRunning)
+			s.config.Metrics.resubscribed(topic, s.config.Subscriber.SubscriptionGroup)
+			return consume, nil
+		}
+
+		if s.isDraining() || ctx.Err() != nil {
+			return nil, nil
+		}
+		if !s.shouldResubscribe(err) {
+			return nil, err
+		}
+		timer.Reset(delay)
+	}
+}
+
+// subscriptionTerminated marks the subscription as dropped with err and calls SubscriberConfig.OnSubscriptionError.
+func (s *Subscriber) subscriptionTerminated(key subscriptionKey, err error) {
+	topic := key.topic
+	s.health.terminate(key, err)
+	s.logger.Error("subscription terminated", err, watermill.LogFields{
+		"topic":              topic,
+		"subscription-group": s.config.Subscriber.SubscriptionGroup,
+		"error-class":        ClassifyError(err),
+	})
+
+	if s.config.Subscriber.OnSubscriptionError != nil {
+		s.config.Subscriber.OnSubscriptionError(topic, err)
+	}
+}
+
+// Err returns the error which terminated a subscription to topic.
+// It's nil while the subscriptions run, and when they ended because their context is done or the subscriber closed.
+func (s *Subscriber) Err(topic string) error {
+	return s.health.terminalError(topic)
+}
+
+// CloseRouterOnSubscriptionError returns a SubscriberConfig.OnSubscriptionError callback which closes router,
+// so a process doesn't keep running with a handler whose subscription died.
+func CloseRouterOnSubscriptionError(router *message.Router, logger watermill.LoggerAdapter) func(topic string, err error) {
+	return func(topic string, err error) {
+		logger.Error("closing router after subscription terminated", err, watermill.LogFields{
+			"topic": topic,
+		})
+
+		// Closing the router closes the subscriber, which waits for the goroutine calling this callback.
+		go func() {
+			if err := router.Close(); err != nil {
+				logger.Error("can't close router", err, nil)
+			}
+		}()
+	}
+}
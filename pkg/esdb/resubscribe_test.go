@@ -0,0 +1,168 @@
+package esdb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/EventStore/EventStore-Client-Go/v4/esdb"
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSubscriptionErrorCallback(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	errs := make(chan error, 1)
+	backend := &memoryBackend{}
+	subscriber := newTestSubscriber(backend, SubscriberConfig{
+		OnSubscriptionError: func(topic string, err error) {
+			assert.Equal(t, "orders", topic)
+			errs <- err
+		},
+	})
+
+	messages, err := subscriber.Subscribe(context.Background(), "orders")
+	require.NoError(t, err)
+	assert.NoError(t, subscriber.Err("orders"))
+
+	dropErr := status.Error(codes.Unavailable, "server is gone")
+	backend.catchUpSubscription(t, 0).drop(dropErr)
+	requireClosed(t, messages)
+
+	assert.Equal(t, dropErr, <-errs)
+	assert.Equal(t, dropErr, subscriber.Err("orders"))
+
+	closeWithin(t, subscriber, time.Second)
+}
+
+func TestResubscribe(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	backend := &memoryBackend{}
+	subscriber := newTestSubscriber(backend, SubscriberConfig{
+		SubscribeToStreamOptions: esdb.SubscribeToStreamOptions{From: esdb.Start{}},
+		Resubscribe:              true,
+		ResubscribeDelay:         time.Millisecond,
+		OnSubscriptionError: func(topic string, err error) {
+			t.Errorf("subscription to %s terminated: %s", topic, err)
+		},
+	})
+
+	messages, err := subscriber.Subscribe(context.Background(), "orders")
+	require.NoError(t, err)
+
+	backend.catchUpSubscription(t, 0).append(newTestEvent(t, "1", 0))
+	receive(t, messages).Ack()
+
+	backend.catchUpSubscription(t, 0).drop(status.Error(codes.Unavailable, "server is gone"))
+	backend.waitForCatchUpSubscriptions(t, 2)
+
+	backend.catchUpSubscription(t, 1).append(newTestEvent(t, "2", 1))
+	m := receive(t, messages)
+	assert.Equal(t, "2", m.UUID, "messages are delivered through the same channel")
+	m.Ack()
+
+	assert.Equal(t, esdb.Start{}, backend.subscribeOptions(0).From)
+	assert.Equal(t, esdb.Revision(0), backend.subscribeOptions(1).From, "resubscribes after the last delivered event")
+	assert.NoError(t, subscriber.Err("orders"))
+
+	closeWithin(t, subscriber, time.Second)
+	requireClosed(t, messages)
+}
+
+func TestSubscribeAgainToSameTopic(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	backend := &memoryBackend{}
+	subscriber := newTestSubscriber(backend, SubscriberConfig{
+		SubscribeToStreamOptions: esdb.SubscribeToStreamOptions{From: esdb.Start{}},
+		Resubscribe:              true,
+		ResubscribeDelay:         time.Millisecond,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	messages, err := subscriber.Subscribe(ctx, "orders")
+	require.NoError(t, err)
+
+	backend.catchUpSubscription(t, 0).append(newTestEvent(t, "1", 7))
+	receive(t, messages).Ack()
+	cancel()
+	requireClosed(t, messages)
+
+	// Another handler of the same topic, or the same one after its context was canceled, gets the whole stream.
+	messages, err = subscriber.Subscribe(context.Background(), "orders")
+	require.NoError(t, err)
+	second, err := subscriber.Subscribe(context.Background(), "orders")
+	require.NoError(t, err)
+
+	assert.Equal(t, esdb.Start{}, backend.subscribeOptions(1).From)
+	assert.Equal(t, esdb.Start{}, backend.subscribeOptions(2).From)
+
+	backend.catchUpSubscription(t, 1).append(newTestEvent(t, "2", 8))
+	receive(t, messages).Ack()
+	backend.catchUpSubscription(t, 1).drop(status.Error(codes.Unavailable, "server is gone"))
+	backend.waitForCatchUpSubscriptions(t, 4)
+
+	assert.Equal(t, esdb.Revision(8), backend.subscribeOptions(3).From, "only the dropped subscription resumes")
+
+	closeWithin(t, subscriber, time.Second)
+	requireClosed(t, messages)
+	requireClosed(t, second)
+}
+
+func TestResubscribeNotOnPermanentErrors(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	backend := &memoryBackend{}
+	subscriber := newTestSubscriber(backend, SubscriberConfig{
+		Resubscribe:      true,
+		ResubscribeDelay: time.Millisecond,
+	})
+
+	messages, err := subscriber.Subscribe(context.Background(), "orders")
+	require.NoError(t, err)
+
+	backend.catchUpSubscription(t, 0).drop(status.Error(codes.PermissionDenied, "access denied"))
+	requireClosed(t, messages)
+
+	assert.Equal(t, ErrorClassAuth, ClassifyError(subscriber.Err("orders")))
+	closeWithin(t, subscriber, time.Second)
+}
+
+func TestCloseRouterOnSubscriptionError(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	logger := watermill.NopLogger{}
+	router, err := message.NewRouter(message.RouterConfig{}, logger)
+	require.NoError(t, err)
+
+	backend := &memoryBackend{}
+	subscriber := newTestSubscriber(backend, SubscriberConfig{})
+	subscriber.config.Subscriber.OnSubscriptionError = CloseRouterOnSubscriptionError(router, logger)
+
+	router.AddNoPublisherHandler("orders", "orders", subscriber, func(msg *message.Message) error {
+		return nil
+	})
+
+	stopped := make(chan error)
+	go func() {
+		stopped <- router.Run(context.Background())
+	}()
+	<-router.Running()
+
+	backend.catchUpSubscription(t, 0).drop(errors.New("connection lost"))
+
+	select {
+	case err := <-stopped:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("router is still running")
+	}
+}
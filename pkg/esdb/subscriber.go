@@ -4,22 +4,39 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/EventStore/EventStore-Client-Go/v4/esdb"
 	"github.com/ThreeDotsLabs/watermill"
 	"github.com/ThreeDotsLabs/watermill/message"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var ErrSubscriberClosed = errors.New("subscriber is closed")
+
+// subscriptionKey identifies the subscription of a single Subscribe call, so subscriptions to the same topic are tracked separately.
+type subscriptionKey struct {
+	topic string
+	id    uint64
+}
+
 type Subscriber struct {
-	client       *esdb.Client
+	client       subscriberClient
 	config       Config
 	subscriberWg *sync.WaitGroup
 	logger       watermill.LoggerAdapter
 	closing      chan struct{}
 	closeFunc    func() error
+	tracer       tracer
+	lag          *lagTracker
+	states       *subscriptionStates
+	health       *healthTracker
+	draining     chan struct{}
+	abandoned    *abandonedMessages
+	lifecycle    *sync.RWMutex
+	lastID       atomic.Uint64
 }
 
 func NewSubscriber(config Config, logger watermill.LoggerAdapter) (*Subscriber, error) {
@@ -31,7 +48,14 @@ func NewSubscriber(config Config, logger watermill.LoggerAdapter) (*Subscriber,
 		return nil, errors.New("conldn't connect to client")
 	}
 
+	return newSubscriber(esdbClient{client}, config, logger), nil
+}
+
+func newSubscriber(client subscriberClient, config Config, logger watermill.LoggerAdapter) *Subscriber {
 	closing := make(chan struct{})
+	draining := make(chan struct{})
+	lifecycle := &sync.RWMutex{}
+	abandoned := &abandonedMessages{}
 	subscriberWg := &sync.WaitGroup{}
 	var closed uint32
 	closeFunc := func() error {
@@ -39,8 +63,15 @@ func NewSubscriber(config Config, logger watermill.LoggerAdapter) (*Subscriber,
 			return nil
 		}
 
+		// Stop pulling new events first and give handlers time to ack the messages they already have.
+		lifecycle.Lock()
+		close(draining)
+		lifecycle.Unlock()
+		waitTimeout(subscriberWg, config.Subscriber.CloseTimeout)
+
 		close(closing)
 		subscriberWg.Wait()
+		abandoned.report(logger)
 
 		return client.Close()
 	}
@@ -52,10 +83,19 @@ func NewSubscriber(config Config, logger watermill.LoggerAdapter) (*Subscriber,
 		logger,
 		closing,
 		closeFunc,
-	}, nil
+		newTracer(config.Tracing),
+		newLagTracker(),
+		newSubscriptionStates(),
+		newHealthTracker(),
+		draining,
+		abandoned,
+		lifecycle,
+		atomic.Uint64{},
+	}
 }
 
-func (s *Subscriber) createPersistentSubscription(ctx context.Context, topic string) error {
+func (s *Subscriber) createPersistentSubscription(ctx context.Context, key subscriptionKey) error {
+	topic := key.topic
 	err := s.client.CreatePersistentSubscription(
 		ctx,
 		topic,
@@ -64,29 +104,55 @@ func (s *Subscriber) createPersistentSubscription(ctx context.Context, topic str
 	)
 
 	if err != nil {
-		if strings.Contains(err.Error(), "AlreadyExists") {
+		if IsAlreadyExists(err) {
 			s.logger.Info("supscription already exists", watermill.LogFields{
 				"topic":              topic,
 				"subscription-group": s.config.Subscriber.SubscriptionGroup,
 			})
 		} else {
+			s.health.setError(key, err)
 			s.logger.Error("can't create persistent subscription", err, watermill.LogFields{
 				"topic":              topic,
 				"subscription-group": s.config.Subscriber.SubscriptionGroup,
+				"error-class":        ClassifyError(err),
 			})
-			return errors.New("can't create persistent subscription")
+			return fmt.Errorf("can't create persistent subscription: %w", err)
 		}
 	}
 
 	return nil
 }
 
-func (s *Subscriber) handlePersistentSubscription(ctx context.Context, topic string) (<-chan *message.Message, error) {
-	ctx, cancel := context.WithCancel(ctx)
-	err := s.createPersistentSubscription(ctx, topic)
+// consumeFunc consumes an open subscription until it ends.
+// It returns the error the subscription was dropped with, or nil when it ended because ctx is done or the subscriber is closing.
+type consumeFunc func(ctx context.Context, out chan *message.Message) error
+
+func (s *Subscriber) openSubscription(ctx context.Context, key subscriptionKey, resume *resumePosition) (consumeFunc, error) {
+	if s.config.Subscriber.SubscriptionGroup != "" {
+		stream, err := s.openPersistentSubscription(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+
+		return func(ctx context.Context, out chan *message.Message) error {
+			return s.consumePersistentSubscription(ctx, key, stream, out)
+		}, nil
+	}
 
+	stream, err := s.openCatchUpSubscription(ctx, key, resume)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(ctx context.Context, out chan *message.Message) error {
+		return s.consumeCatchUpSubscription(ctx, key, stream, resume, out)
+	}, nil
+}
+
+func (s *Subscriber) openPersistentSubscription(ctx context.Context, key subscriptionKey) (persistentSubscription, error) {
+	topic := key.topic
+	err := s.createPersistentSubscription(ctx, key)
 	if err != nil {
-		cancel()
 		return nil, err
 	}
 
@@ -98,154 +164,345 @@ func (s *Subscriber) handlePersistentSubscription(ctx context.Context, topic str
 	)
 
 	if err != nil {
-		cancel()
+		s.health.setError(key, err)
 		s.logger.Error("can't subscribe to stream", err, watermill.LogFields{
 			"topic": topic,
 		})
-		return nil, errors.New("can't subscribe to stream")
+		return nil, fmt.Errorf("can't subscribe to stream: %w", err)
 	}
 
-	out := make(chan *message.Message)
-	in := make(chan *esdb.ResolvedEvent)
-	s.subscriberWg.Add(1)
+	return stream, nil
+}
 
+func (s *Subscriber) openCatchUpSubscription(ctx context.Context, key subscriptionKey, resume *resumePosition) (catchUpSubscription, error) {
+	topic := key.topic
+	options := s.config.Subscriber.SubscribeToStreamOptions
+	if resume.delivered {
+		// When resubscribing, continue after the last delivered event.
+		options.From = esdb.Revision(resume.revision)
+	} else if !s.config.Subscriber.FromTime.IsZero() {
+		from, err := s.PositionAt(ctx, topic, s.config.Subscriber.FromTime)
+		if err != nil {
+			s.health.setError(key, err)
+			s.logger.Error("can't find position to subscribe from", err, watermill.LogFields{
+				"topic":     topic,
+				"from-time": s.config.Subscriber.FromTime,
+			})
+			return nil, fmt.Errorf("can't find position to subscribe from: %w", err)
+		}
+		options.From = from
+		s.lag.setStart(key, from)
+	}
+
+	stream, err := s.client.SubscribeToStream(ctx, topic, options)
+	if err != nil {
+		s.health.setError(key, err)
+		s.logger.Error("can't subscribe to stream", err, watermill.LogFields{
+			"topic": topic,
+		})
+		return nil, fmt.Errorf("can't subscribe to stream: %w", err)
+	}
+
+	s.setSubscriptionState(key, SubscriptionStateCatchingUp)
+
+	return stream, nil
+}
+
+// droppedError returns the error the subscription was dropped with, or nil when it ended because ctx is done or the subscriber is closing.
+func (s *Subscriber) droppedError(ctx context.Context, dropped *esdb.SubscriptionDropped) error {
+	if dropped == nil || s.isDraining() || ctx.Err() != nil {
+		return nil
+	}
+
+	if dropped.Error == nil {
+		return errors.New("subscription dropped")
+	}
+	return dropped.Error
+}
+
+func (s *Subscriber) consumePersistentSubscription(
+	ctx context.Context,
+	key subscriptionKey,
+	stream persistentSubscription,
+	out chan *message.Message,
+) error {
+	topic := key.topic
+	in := make(chan *esdb.EventAppeared)
+	// done is closed when consuming ends, so the reader doesn't block on in.
+	done := make(chan struct{})
+	defer func() {
+		close(done)
+		stream.Close()
+	}()
+
+	// dropped is written by the reader before it closes in.
+	var dropped *esdb.SubscriptionDropped
+	s.subscriberWg.Add(1)
 	go func() {
 		defer func() {
-			stream.Close()
-			close(out)
-			cancel()
+			close(in)
 			s.subscriberWg.Done()
 		}()
 		for {
-			select {
-			case <-s.closing:
-				return
-			case <-ctx.Done():
+			event := stream.Recv()
+
+			if event.SubscriptionDropped != nil {
+				s.logger.Debug("subscription dropped", watermill.LogFields{
+					"event":       event,
+					"topic":       topic,
+					"error-class": ClassifyError(event.SubscriptionDropped.Error),
+				})
+				dropped = event.SubscriptionDropped
 				return
-			case event := <-in:
-				m, err := s.config.Marshaler.Unmarshal(event)
-				if err != nil {
-					s.logger.Error("couldn't unmarshal message", err, watermill.LogFields{
-						"event": event,
-					})
+			}
 
-					continue
-				}
-				if success := s.sendMessage(ctx, m, out); success {
-					err := stream.Ack(event)
-					if err != nil {
-						s.logger.Error("couldn't acc message", err, watermill.LogFields{
-							"event": event,
-						})
-					}
-				} else {
-					err := stream.Nack(fmt.Sprintf("nack event %s", m.UUID), esdb.NackActionSkip, event)
-					if err != nil {
-						s.logger.Error("couldn't nack message", err, watermill.LogFields{
-							"event": event,
-						})
-					}
+			if event.EventAppeared != nil {
+				select {
+				case in <- event.EventAppeared:
+				case <-done:
+					return
 				}
 			}
 		}
 	}()
 
-	go func() {
-		defer close(in)
-		for {
-			event := stream.Recv()
+	for {
+		if s.isDraining() {
+			return nil
+		}
 
-			if event.SubscriptionDropped != nil {
-				s.logger.Debug("subscription dropped", watermill.LogFields{
+		select {
+		case <-s.draining:
+			return nil
+		case <-ctx.Done():
+			return nil
+		case appeared, ok := <-in:
+			if !ok {
+				return s.droppedError(ctx, dropped)
+			}
+			event := appeared.Event
+			m, err := s.config.Marshaler.Unmarshal(event)
+			if err != nil {
+				s.logger.Error("couldn't unmarshal message", err, watermill.LogFields{
 					"event": event,
 					"topic": topic,
 				})
-				return
-			}
+				s.config.Metrics.unmarshalFailed(topic, s.config.Subscriber.SubscriptionGroup)
 
-			if event.EventAppeared != nil {
-				in <- event.EventAppeared.Event
+				continue
+			}
+			if success := s.deliverMessage(ctx, topic, event, appeared.RetryCount, m, out); success {
+				err := stream.Ack(event)
+				if err != nil {
+					s.health.setError(key, err)
+					s.logger.Error("couldn't acc message", err, watermill.LogFields{
+						"event": event,
+					})
+				}
+			} else {
+				// The message wasn't acked because the subscription is closing, so it's retried by another consumer.
+				s.abandoned.add(topic, m.UUID)
+				err := stream.Nack(fmt.Sprintf("abandoned event %s", m.UUID), esdb.NackActionRetry, event)
+				if err != nil {
+					s.health.setError(key, err)
+					s.logger.Error("couldn't nack message", err, watermill.LogFields{
+						"event": event,
+					})
+				}
 			}
 		}
-	}()
-
-	return out, nil
+	}
 }
 
-func (s *Subscriber) handleCatchUpSubscription(ctx context.Context, topic string) (<-chan *message.Message, error) {
-	ctx, cancel := context.WithCancel(ctx)
-	stream, err := s.client.SubscribeToStream(ctx, topic, s.config.Subscriber.SubscribeToStreamOptions)
-	if err != nil {
-		cancel()
-		s.logger.Error("can't subscribe to stream", err, watermill.LogFields{
-			"topic": topic,
-		})
-		return nil, errors.New("can't subscribe to stream")
-	}
+func (s *Subscriber) consumeCatchUpSubscription(
+	ctx context.Context,
+	key subscriptionKey,
+	stream catchUpSubscription,
+	resume *resumePosition,
+	out chan *message.Message,
+) error {
+	topic := key.topic
+	// Caught up and fell behind signals go through the same channel as events,
+	// so the state changes only after the events before them were handled.
+	in := make(chan *esdb.SubscriptionEvent)
+	// done is closed when consuming ends, so the reader doesn't block on in.
+	done := make(chan struct{})
+	defer func() {
+		close(done)
+		stream.Close()
+	}()
 
-	out := make(chan *message.Message)
-	in := make(chan *esdb.ResolvedEvent)
+	// dropped is written by the reader before it closes in.
+	var dropped *esdb.SubscriptionDropped
+	s.subscriberWg.Add(1)
 	go func() {
 		defer func() {
-			stream.Close()
-			close(out)
-			cancel()
+			close(in)
 			s.subscriberWg.Done()
 		}()
 		for {
-			select {
-			case <-s.closing:
-				return
-			case <-ctx.Done():
+			event := stream.Recv()
+
+			if event.SubscriptionDropped != nil {
+				s.logger.Debug("subscription dropped", watermill.LogFields{
+					"event":       event,
+					"topic":       topic,
+					"error-class": ClassifyError(event.SubscriptionDropped.Error),
+				})
+				dropped = event.SubscriptionDropped
 				return
-			case event := <-in:
-				m, err := s.config.Marshaler.Unmarshal(event)
-				if err != nil {
-					s.logger.Error("couldn't unmarshal message", err, watermill.LogFields{
-						"event": event,
-					})
+			}
 
-					continue
+			if event.EventAppeared != nil || event.CaughtUp != nil || event.FellBehind != nil {
+				select {
+				case in <- event:
+				case <-done:
+					return
 				}
-
-				s.sendMessage(ctx, m, out)
 			}
 		}
 	}()
-	s.subscriberWg.Add(1)
 
-	go func() {
-		defer close(in)
-		for {
-			event := stream.Recv()
+	for {
+		if s.isDraining() {
+			return nil
+		}
 
-			if event.SubscriptionDropped != nil {
-				s.logger.Debug("subscription dropped", watermill.LogFields{
+		select {
+		case <-s.draining:
+			return nil
+		case <-ctx.Done():
+			return nil
+		case subscriptionEvent, ok := <-in:
+			if !ok {
+				return s.droppedError(ctx, dropped)
+			}
+			if subscriptionEvent.CaughtUp != nil {
+				s.setSubscriptionState(key, SubscriptionStateLive)
+				continue
+			}
+			if subscriptionEvent.FellBehind != nil {
+				s.setSubscriptionState(key, SubscriptionStateCatchingUp)
+				continue
+			}
+
+			event := subscriptionEvent.EventAppeared
+			m, err := s.config.Marshaler.Unmarshal(event)
+			if err != nil {
+				s.logger.Error("couldn't unmarshal message", err, watermill.LogFields{
 					"event": event,
 					"topic": topic,
 				})
-				return
+				s.config.Metrics.unmarshalFailed(topic, s.config.Subscriber.SubscriptionGroup)
+
+				continue
 			}
 
-			if event.EventAppeared != nil {
-				in <- event.EventAppeared
+			if s.deliverMessage(ctx, topic, event, 0, m, out) {
+				resume.setDelivered(event)
+				s.lag.setDelivered(key, event)
+			} else {
+				s.abandoned.add(topic, m.UUID)
 			}
 		}
+	}
+}
+
+// runSubscription consumes the subscription until it ends, resubscribing after drops when enabled.
+func (s *Subscriber) runSubscription(
+	ctx context.Context,
+	cancel context.CancelFunc,
+	key subscriptionKey,
+	consume consumeFunc,
+	resume *resumePosition,
+	out chan *message.Message,
+) {
+	defer func() {
+		s.subscriptionEnded(ctx, key)
+		close(out)
+		cancel()
+		s.subscriberWg.Done()
 	}()
 
-	return out, nil
+	for {
+		err := consume(ctx, out)
+		if err == nil {
+			return
+		}
+		s.subscriptionDropped(key)
+
+		if !s.shouldResubscribe(err) {
+			s.subscriptionTerminated(key, err)
+			return
+		}
+
+		consume, err = s.resubscribe(ctx, key, resume, err)
+		if err != nil {
+			s.subscriptionTerminated(key, err)
+			return
+		}
+		if consume == nil {
+			return
+		}
+	}
 }
 
 func (s *Subscriber) Subscribe(ctx context.Context, topic string) (<-chan *message.Message, error) {
-	if s.config.Subscriber.SubscriptionGroup != "" {
-		return s.handlePersistentSubscription(ctx, topic)
+	// Subscribing holds the read lock, so Close doesn't start waiting for goroutines while new ones are added.
+	s.lifecycle.RLock()
+	defer s.lifecycle.RUnlock()
+
+	if s.isDraining() {
+		return nil, ErrSubscriberClosed
 	}
 
-	return s.handleCatchUpSubscription(ctx, topic)
+	ctx, cancel := context.WithCancel(ctx)
+	key := subscriptionKey{topic: topic, id: s.lastID.Add(1)}
+	resume := &resumePosition{}
+	consume, err := s.openSubscription(ctx, key, resume)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	s.health.setStatus(key, SubscriptionStatusRunning)
+
+	out := make(chan *message.Message)
+	s.subscriberWg.Add(1)
+	go s.runSubscription(ctx, cancel, key, consume, resume, out)
+
+	s.watchLag(ctx, key)
+	return out, nil
+}
+
+// deliverMessage sends m, unmarshaled from event, to out within a receive span, and reports whether it was acked.
+func (s *Subscriber) deliverMessage(
+	ctx context.Context,
+	topic string,
+	event *esdb.ResolvedEvent,
+	retryCount int,
+	m *message.Message,
+	out chan *message.Message,
+) bool {
+	group := s.config.Subscriber.SubscriptionGroup
+	ctx, span := s.tracer.startReceive(ctx, topic, group, event, retryCount, m)
+
+	start := time.Now()
+	s.config.Metrics.messageDelivered(topic, group)
+	acked := s.sendMessage(ctx, topic, m, out)
+	s.config.Metrics.messageHandled(topic, group, acked, time.Since(start))
+
+	if acked {
+		endSpan(span, nil)
+	} else {
+		endSpan(span, errors.New("message was not acked"))
+	}
+
+	return acked
 }
 
 func (s *Subscriber) sendMessage(
 	ctx context.Context,
+	topic string,
 	m *message.Message,
 	out chan *message.Message,
 ) bool {
@@ -257,7 +514,7 @@ ResendLoop:
 	for {
 		select {
 		case out <- m:
-		case <-s.closing:
+		case <-s.draining:
 			s.logger.Debug("closing subscriber", watermill.LogFields{
 				"message": m,
 			})
@@ -273,6 +530,8 @@ ResendLoop:
 		case <-m.Acked():
 			return true
 		case <-m.Nacked():
+			trace.SpanFromContext(ctx).AddEvent("message nacked")
+			s.config.Metrics.messageNacked(topic, s.config.Subscriber.SubscriptionGroup)
 			m = m.Copy()
 			m.SetContext(msgCtx)
 			continue ResendLoop
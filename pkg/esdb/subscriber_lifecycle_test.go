@@ -0,0 +1,242 @@
+package esdb
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/EventStore/EventStore-Client-Go/v4/esdb"
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+func newTestSubscriber(backend *memoryBackend, config SubscriberConfig) *Subscriber {
+	return newSubscriber(backend, Config{
+		Marshaler:  DefaultMarshaler{},
+		Subscriber: config,
+	}, watermill.NopLogger{})
+}
+
+func receive(t *testing.T, messages <-chan *message.Message) *message.Message {
+	t.Helper()
+
+	select {
+	case m, ok := <-messages:
+		require.True(t, ok, "messages channel was closed")
+		return m
+	case <-time.After(time.Second):
+		t.Fatal("message not received")
+		return nil
+	}
+}
+
+func requireClosed(t *testing.T, messages <-chan *message.Message) {
+	t.Helper()
+
+	select {
+	case _, ok := <-messages:
+		require.False(t, ok, "messages channel is not closed")
+	case <-time.After(time.Second):
+		t.Fatal("messages channel is not closed")
+	}
+}
+
+func closeWithin(t *testing.T, subscriber *Subscriber, timeout time.Duration) {
+	t.Helper()
+
+	closed := make(chan error)
+	go func() {
+		closed <- subscriber.Close()
+	}()
+
+	select {
+	case err := <-closed:
+		require.NoError(t, err)
+	case <-time.After(timeout):
+		t.Fatal("Close hangs")
+	}
+}
+
+func TestCloseWithBlockedReader(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	backend := &memoryBackend{}
+	subscriber := newTestSubscriber(backend, SubscriberConfig{})
+
+	messages, err := subscriber.Subscribe(context.Background(), "orders")
+	require.NoError(t, err)
+
+	// Nobody reads messages, so the first event blocks the processing goroutine and the second one the reader.
+	subscription := backend.catchUpSubscription(t, 0)
+	subscription.append(newTestEvent(t, "1", 0))
+	subscription.append(newTestEvent(t, "2", 1))
+	time.Sleep(10 * time.Millisecond)
+
+	closeWithin(t, subscriber, time.Second)
+	requireClosed(t, messages)
+}
+
+func TestCloseWaitsForInFlightMessages(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	backend := &memoryBackend{}
+	subscriber := newTestSubscriber(backend, SubscriberConfig{
+		SubscriptionGroup: "group",
+		CloseTimeout:      time.Second,
+	})
+
+	messages, err := subscriber.Subscribe(context.Background(), "orders")
+	require.NoError(t, err)
+
+	subscription := backend.persistentSubscription(t, 0)
+	event := newTestEvent(t, "1", 0)
+	subscription.append(event)
+	subscription.append(newTestEvent(t, "2", 1))
+
+	m := receive(t, messages)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		m.Ack()
+	}()
+
+	closeWithin(t, subscriber, time.Second)
+	requireClosed(t, messages)
+
+	assert.Equal(t, []*esdb.ResolvedEvent{event}, subscription.ackedEvents())
+	assert.Empty(t, subscription.nackedEvents(esdb.NackActionRetry), "events not delivered yet are left to the server")
+	assert.Empty(t, subscriber.Abandoned())
+}
+
+func TestCloseAbandonsUnackedMessages(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	backend := &memoryBackend{}
+	subscriber := newTestSubscriber(backend, SubscriberConfig{
+		SubscriptionGroup: "group",
+		CloseTimeout:      10 * time.Millisecond,
+	})
+
+	messages, err := subscriber.Subscribe(context.Background(), "orders")
+	require.NoError(t, err)
+
+	subscription := backend.persistentSubscription(t, 0)
+	event := newTestEvent(t, "1", 0)
+	subscription.append(event)
+	receive(t, messages)
+
+	closeWithin(t, subscriber, time.Second)
+
+	assert.Empty(t, subscription.ackedEvents())
+	assert.Equal(t, []*esdb.ResolvedEvent{event}, subscription.nackedEvents(esdb.NackActionRetry))
+	assert.Equal(t, []AbandonedMessage{{Topic: "orders", UUID: "1"}}, subscriber.Abandoned())
+}
+
+func TestSubscriptionDroppedClosesMessages(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	backend := &memoryBackend{}
+	subscriber := newTestSubscriber(backend, SubscriberConfig{})
+
+	messages, err := subscriber.Subscribe(context.Background(), "orders")
+	require.NoError(t, err)
+
+	dropErr := errors.New("connection lost")
+	backend.catchUpSubscription(t, 0).drop(dropErr)
+	requireClosed(t, messages)
+
+	health := subscriber.Health(context.Background())
+	assert.False(t, health.Healthy())
+	require.Len(t, health.Subscriptions, 1)
+	assert.Equal(t, SubscriptionStatusDropped, health.Subscriptions[0].Status)
+	assert.Equal(t, dropErr, health.Subscriptions[0].LastError)
+
+	closeWithin(t, subscriber, time.Second)
+}
+
+func TestSubscriptionContextCanceled(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	backend := &memoryBackend{}
+	subscriber := newTestSubscriber(backend, SubscriberConfig{SubscriptionGroup: "group"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	messages, err := subscriber.Subscribe(ctx, "orders")
+	require.NoError(t, err)
+
+	cancel()
+	requireClosed(t, messages)
+
+	closeWithin(t, subscriber, time.Second)
+	assert.Empty(t, subscriber.Health(context.Background()).Subscriptions)
+}
+
+func TestSubscribeAfterClose(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	subscriber := newTestSubscriber(&memoryBackend{}, SubscriberConfig{})
+	closeWithin(t, subscriber, time.Second)
+
+	_, err := subscriber.Subscribe(context.Background(), "orders")
+	assert.ErrorIs(t, err, ErrSubscriberClosed)
+}
+
+func TestConcurrentSubscribeAndClose(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	backend := &memoryBackend{}
+	subscriber := newTestSubscriber(backend, SubscriberConfig{})
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			messages, err := subscriber.Subscribe(context.Background(), "orders")
+			if err != nil {
+				assert.ErrorIs(t, err, ErrSubscriberClosed)
+				return
+			}
+			for range messages {
+			}
+		}()
+	}
+
+	closeWithin(t, subscriber, time.Second)
+	wg.Wait()
+}
+
+type failingMarshaler struct {
+	DefaultMarshaler
+}
+
+func (failingMarshaler) Unmarshal(*esdb.ResolvedEvent) (*message.Message, error) {
+	return nil, errors.New("key store is unavailable")
+}
+
+func TestUnmarshalFailureLeavesEventUnacked(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	backend := &memoryBackend{}
+	subscriber := newSubscriber(backend, Config{
+		Marshaler:  failingMarshaler{},
+		Subscriber: SubscriberConfig{SubscriptionGroup: "group"},
+	}, watermill.NopLogger{})
+
+	_, err := subscriber.Subscribe(context.Background(), "orders")
+	require.NoError(t, err)
+
+	subscription := backend.persistentSubscription(t, 0)
+	subscription.append(newTestEvent(t, "1", 0))
+	time.Sleep(10 * time.Millisecond)
+	closeWithin(t, subscriber, time.Second)
+
+	// The server redelivers the event, so transient failures of the marshaler don't lose it.
+	assert.Empty(t, subscription.ackedEvents())
+	assert.Empty(t, subscription.nackedEvents(esdb.NackActionPark))
+}
@@ -0,0 +1,141 @@
+package esdb
+
+import (
+	"sync"
+)
+
+// SubscriptionState is the state of a catch-up subscription.
+type SubscriptionState string
+
+const (
+	// The subscription is reading past events.
+	SubscriptionStateCatchingUp SubscriptionState = "catching_up"
+	// The subscription has handled all past events and receives new events as they are appended.
+	SubscriptionStateLive SubscriptionState = "live"
+	// The subscription was dropped. It's catching up again when it's resubscribed.
+	SubscriptionStateDropped SubscriptionState = "dropped"
+)
+
+// subscriptionStates keeps the state of each catch-up subscription.
+type subscriptionStates struct {
+	lock   sync.RWMutex
+	states map[subscriptionKey]SubscriptionState
+}
+
+func newSubscriptionStates() *subscriptionStates {
+	return &subscriptionStates{
+		states: map[subscriptionKey]SubscriptionState{},
+	}
+}
+
+// set stores state of the subscription and reports whether it changed.
+func (s *subscriptionStates) set(key subscriptionKey, state SubscriptionState) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if current, ok := s.states[key]; ok && current == state {
+		return false
+	}
+
+	s.states[key] = state
+	return true
+}
+
+func (s *subscriptionStates) remove(key subscriptionKey) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.states, key)
+}
+
+func (s *subscriptionStates) get(key subscriptionKey) (SubscriptionState, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	state, ok := s.states[key]
+	return state, ok
+}
+
+// topicState returns the state of the least advanced catch-up subscription to topic.
+func (s *subscriptionStates) topicState(topic string) (SubscriptionState, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	var state SubscriptionState
+	found := false
+	for key, current := range s.states {
+		if key.topic != topic {
+			continue
+		}
+		if !found || stateOrder(current) < stateOrder(state) {
+			state = current
+		}
+		found = true
+	}
+
+	return state, found
+}
+
+// stateOrder orders states from dropped to live.
+func stateOrder(state SubscriptionState) int {
+	switch state {
+	case SubscriptionStateDropped:
+		return 0
+	case SubscriptionStateCatchingUp:
+		return 1
+	default:
+		return 2
+	}
+}
+
+func (s *subscriptionStates) allLive() bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	for _, state := range s.states {
+		if state != SubscriptionStateLive {
+			return false
+		}
+	}
+
+	return true
+}
+
+// setSubscriptionState stores state of the subscription and calls SubscriberConfig.OnStateChange when it changed.
+func (s *Subscriber) setSubscriptionState(key subscriptionKey, state SubscriptionState) {
+	if !s.states.set(key, state) {
+		return
+	}
+
+	if s.config.Subscriber.OnStateChange != nil {
+		s.config.Subscriber.OnStateChange(key.topic, state)
+	}
+}
+
+// subscriptionDropped marks the catch-up subscription as dropped, so it's no longer live.
+func (s *Subscriber) subscriptionDropped(key subscriptionKey) {
+	if s.config.Subscriber.SubscriptionGroup != "" {
+		return
+	}
+
+	s.setSubscriptionState(key, SubscriptionStateDropped)
+}
+
+// State returns the state of the catch-up subscriptions to topic.
+// With several subscriptions to topic, it's the state of the one furthest behind.
+// It reports false when there is no catch-up subscription to topic.
+func (s *Subscriber) State(topic string) (SubscriptionState, bool) {
+	return s.states.topicState(topic)
+}
+
+// IsLive reports whether all catch-up subscriptions to topic have handled all past events.
+func (s *Subscriber) IsLive(topic string) bool {
+	state, _ := s.states.topicState(topic)
+	return state == SubscriptionStateLive
+}
+
+// Ready reports whether the subscriber has subscriptions, all of them are running and its catch-up subscriptions are live.
+// Persistent subscriptions don't report their state, so they are ready while they run.
+func (s *Subscriber) Ready() bool {
+	return s.health.allRunning() && s.states.allLive()
+}
@@ -0,0 +1,193 @@
+package esdb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSubscriptionState(t *testing.T) {
+	type change struct {
+		topic string
+		state SubscriptionState
+	}
+	var changes []change
+
+	subscriber := &Subscriber{
+		config: Config{
+			Subscriber: SubscriberConfig{
+				OnStateChange: func(topic string, state SubscriptionState) {
+					changes = append(changes, change{topic, state})
+				},
+			},
+		},
+		states: newSubscriptionStates(),
+		health: newHealthTracker(),
+	}
+	orders := subscriptionKey{topic: "orders", id: 1}
+	payments := subscriptionKey{topic: "payments", id: 2}
+
+	assert.False(t, subscriber.Ready(), "subscriber without subscriptions isn't ready")
+	_, ok := subscriber.State("orders")
+	assert.False(t, ok)
+
+	subscriber.health.setStatus(orders, SubscriptionStatusRunning)
+	subscriber.health.setStatus(payments, SubscriptionStatusRunning)
+	subscriber.setSubscriptionState(orders, SubscriptionStateCatchingUp)
+	subscriber.setSubscriptionState(payments, SubscriptionStateCatchingUp)
+	assert.False(t, subscriber.Ready())
+
+	subscriber.setSubscriptionState(orders, SubscriptionStateLive)
+	subscriber.setSubscriptionState(orders, SubscriptionStateLive)
+	assert.True(t, subscriber.IsLive("orders"))
+	assert.False(t, subscriber.IsLive("payments"))
+	assert.False(t, subscriber.Ready())
+
+	subscriber.setSubscriptionState(payments, SubscriptionStateLive)
+	assert.True(t, subscriber.Ready())
+
+	subscriber.setSubscriptionState(orders, SubscriptionStateCatchingUp)
+	state, ok := subscriber.State("orders")
+	assert.True(t, ok)
+	assert.Equal(t, SubscriptionStateCatchingUp, state)
+	assert.False(t, subscriber.Ready())
+
+	assert.Equal(t, []change{
+		{"orders", SubscriptionStateCatchingUp},
+		{"payments", SubscriptionStateCatchingUp},
+		{"orders", SubscriptionStateLive},
+		{"payments", SubscriptionStateLive},
+		{"orders", SubscriptionStateCatchingUp},
+	}, changes, "callback is called only on changes")
+}
+
+func TestSubscriptionsToSameTopicHaveOwnState(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	backend := &memoryBackend{}
+	subscriber := newTestSubscriber(backend, SubscriberConfig{})
+	assert.False(t, subscriber.Ready(), "subscriber without subscriptions isn't ready")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first, err := subscriber.Subscribe(ctx, "orders")
+	require.NoError(t, err)
+	_, err = subscriber.Subscribe(context.Background(), "orders")
+	require.NoError(t, err)
+
+	backend.catchUpSubscription(t, 0).caughtUp()
+	require.Never(t, subscriber.Ready, 50*time.Millisecond, time.Millisecond, "second subscription is catching up")
+	assert.False(t, subscriber.IsLive("orders"))
+	state, _ := subscriber.State("orders")
+	assert.Equal(t, SubscriptionStateCatchingUp, state)
+
+	cancel()
+	requireClosed(t, first)
+	assert.False(t, subscriber.Ready(), "second subscription is still catching up")
+
+	backend.catchUpSubscription(t, 1).caughtUp()
+	requireState(t, subscriber, "orders", SubscriptionStateLive)
+	assert.True(t, subscriber.Ready())
+
+	closeWithin(t, subscriber, time.Second)
+}
+
+func requireState(t *testing.T, subscriber *Subscriber, topic string, expected SubscriptionState) {
+	t.Helper()
+
+	require.Eventually(t, func() bool {
+		state, _ := subscriber.State(topic)
+		return state == expected
+	}, time.Second, time.Millisecond, "subscription to %s isn't %s", topic, expected)
+}
+
+func TestDroppedSubscriptionIsNotLive(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	backend := &memoryBackend{}
+	subscriber := newTestSubscriber(backend, SubscriberConfig{})
+
+	messages, err := subscriber.Subscribe(context.Background(), "orders")
+	require.NoError(t, err)
+
+	backend.catchUpSubscription(t, 0).caughtUp()
+	requireState(t, subscriber, "orders", SubscriptionStateLive)
+	assert.True(t, subscriber.Ready())
+
+	backend.catchUpSubscription(t, 0).drop(status.Error(codes.Unavailable, "server is gone"))
+	requireClosed(t, messages)
+
+	assert.False(t, subscriber.IsLive("orders"))
+	assert.False(t, subscriber.Ready())
+	state, _ := subscriber.State("orders")
+	assert.Equal(t, SubscriptionStateDropped, state)
+
+	closeWithin(t, subscriber, time.Second)
+}
+
+func TestResubscribedSubscriptionCatchesUp(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	var changes []SubscriptionState
+	backend := &memoryBackend{}
+	subscriber := newTestSubscriber(backend, SubscriberConfig{
+		Resubscribe:      true,
+		ResubscribeDelay: time.Millisecond,
+		OnStateChange: func(_ string, state SubscriptionState) {
+			changes = append(changes, state)
+		},
+	})
+
+	_, err := subscriber.Subscribe(context.Background(), "orders")
+	require.NoError(t, err)
+
+	backend.catchUpSubscription(t, 0).caughtUp()
+	requireState(t, subscriber, "orders", SubscriptionStateLive)
+
+	backend.catchUpSubscription(t, 0).drop(status.Error(codes.Unavailable, "server is gone"))
+	backend.waitForCatchUpSubscriptions(t, 2)
+	requireState(t, subscriber, "orders", SubscriptionStateCatchingUp)
+
+	backend.catchUpSubscription(t, 1).caughtUp()
+	requireState(t, subscriber, "orders", SubscriptionStateLive)
+
+	closeWithin(t, subscriber, time.Second)
+	assert.Equal(t, []SubscriptionState{
+		SubscriptionStateCatchingUp,
+		SubscriptionStateLive,
+		SubscriptionStateDropped,
+		SubscriptionStateCatchingUp,
+		SubscriptionStateLive,
+	}, changes)
+}
+
+func TestEndedSubscriptionIsForgotten(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	backend := &memoryBackend{}
+	subscriber := newTestSubscriber(backend, SubscriberConfig{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	messages, err := subscriber.Subscribe(ctx, "orders")
+	require.NoError(t, err)
+	_, err = subscriber.Subscribe(context.Background(), "payments")
+	require.NoError(t, err)
+
+	backend.catchUpSubscription(t, 1).caughtUp()
+	requireState(t, subscriber, "payments", SubscriptionStateLive)
+	assert.False(t, subscriber.Ready(), "orders is catching up")
+
+	cancel()
+	requireClosed(t, messages)
+
+	_, ok := subscriber.State("orders")
+	assert.False(t, ok)
+	assert.True(t, subscriber.Ready())
+
+	closeWithin(t, subscriber, time.Second)
+}
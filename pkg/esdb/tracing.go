@@ -0,0 +1,120 @@
+package esdb
+
+import (
+	"context"
+
+	"github.com/EventStore/EventStore-Client-Go/v4/esdb"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const tracerName = "github.com/KirylJazzSax/watermill-eventstore/pkg/esdb"
+
+// Attributes set on publish and receive spans.
+const (
+	MessagingSystemAttribute   = attribute.Key("messaging.system")
+	MessageIDAttribute         = attribute.Key("messaging.message.id")
+	StreamAttribute            = attribute.Key("eventstoredb.stream")
+	RevisionAttribute          = attribute.Key("eventstoredb.revision")
+	EventTypeAttribute         = attribute.Key("eventstoredb.event_type")
+	SubscriptionGroupAttribute = attribute.Key("eventstoredb.subscription_group")
+	RetryCountAttribute        = attribute.Key("eventstoredb.retry_count")
+)
+
+type TracingConfig struct {
+	// TracerProvider used to create spans. When nil, no spans are recorded.
+	TracerProvider trace.TracerProvider
+	// Propagator used to carry the trace context in event metadata. Defaults to W3C trace context.
+	Propagator propagation.TextMapPropagator
+}
+
+type tracer struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+func newTracer(config TracingConfig) tracer {
+	tracerProvider := config.TracerProvider
+	if tracerProvider == nil {
+		tracerProvider = noop.NewTracerProvider()
+	}
+
+	propagator := config.Propagator
+	if propagator == nil {
+		propagator = propagation.TraceContext{}
+	}
+
+	return tracer{
+		tracer:     tracerProvider.Tracer(tracerName),
+		propagator: propagator,
+	}
+}
+
+// startPublish starts the span of appending msg to stream.
+// It returns a copy of msg carrying the trace context in its metadata, so the caller's message isn't modified.
+func (t tracer) startPublish(stream string, msg *message.Message) (context.Context, trace.Span, *message.Message) {
+	ctx, span := t.tracer.Start(
+		msg.Context(),
+		"publish "+stream,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			MessagingSystemAttribute.String("eventstoredb"),
+			MessageIDAttribute.String(msg.UUID),
+			StreamAttribute.String(stream),
+		),
+	)
+
+	traced := msg.Copy()
+	traced.SetContext(ctx)
+	t.propagator.Inject(ctx, propagation.MapCarrier(traced.Metadata))
+
+	return ctx, span, traced
+}
+
+// startReceive starts the span of delivering msg, continuing the trace carried in its metadata.
+func (t tracer) startReceive(
+	ctx context.Context,
+	topic string,
+	subscriptionGroup string,
+	event *esdb.ResolvedEvent,
+	retryCount int,
+	msg *message.Message,
+) (context.Context, trace.Span) {
+	parent := t.propagator.Extract(ctx, propagation.MapCarrier(msg.Metadata))
+
+	attributes := []attribute.KeyValue{
+		MessagingSystemAttribute.String("eventstoredb"),
+		MessageIDAttribute.String(msg.UUID),
+		StreamAttribute.String(topic),
+		RetryCountAttribute.Int(retryCount),
+	}
+	if recorded := event.OriginalEvent(); recorded != nil {
+		attributes = append(
+			attributes,
+			RevisionAttribute.Int64(int64(recorded.EventNumber)),
+			EventTypeAttribute.String(event.Event.EventType),
+		)
+	}
+	if subscriptionGroup != "" {
+		attributes = append(attributes, SubscriptionGroupAttribute.String(subscriptionGroup))
+	}
+
+	return t.tracer.Start(
+		parent,
+		"receive "+topic,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attributes...),
+	)
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,68 @@
+package esdb
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/EventStore/EventStore-Client-Go/v4/esdb"
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newTestTracer() (tracer, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	return newTracer(TracingConfig{TracerProvider: tracerProvider}), exporter
+}
+
+func TestTraceContextPropagation(t *testing.T) {
+	tracer, exporter := newTestTracer()
+	msg := message.NewMessage(watermill.NewUUID(), []byte(`{}`))
+
+	_, publishSpan, traced := tracer.startPublish("orders", msg)
+	endSpan(publishSpan, nil)
+
+	assert.NotEmpty(t, traced.Metadata.Get("traceparent"))
+	assert.Empty(t, msg.Metadata.Get("traceparent"))
+
+	event := &esdb.ResolvedEvent{
+		Event: &esdb.RecordedEvent{
+			EventType:   "order_placed",
+			EventNumber: 7,
+		},
+	}
+	ctx, receiveSpan := tracer.startReceive(context.Background(), "orders", "group", event, 2, traced)
+	endSpan(receiveSpan, errors.New("message was not acked"))
+
+	assert.Equal(t, publishSpan.SpanContext().TraceID(), trace.SpanContextFromContext(ctx).TraceID())
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "publish orders", spans[0].Name)
+	assert.Equal(t, trace.SpanKindProducer, spans[0].SpanKind)
+	assert.Equal(t, "receive orders", spans[1].Name)
+	assert.Equal(t, spans[0].SpanContext.SpanID(), spans[1].Parent.SpanID())
+	assert.Contains(t, spans[1].Attributes, RevisionAttribute.Int64(7))
+	assert.Contains(t, spans[1].Attributes, EventTypeAttribute.String("order_placed"))
+	assert.Contains(t, spans[1].Attributes, SubscriptionGroupAttribute.String("group"))
+	assert.Contains(t, spans[1].Attributes, RetryCountAttribute.Int(2))
+	assert.Len(t, spans[1].Events, 1)
+}
+
+func TestTracingDisabled(t *testing.T) {
+	tracer := newTracer(TracingConfig{})
+	msg := message.NewMessage(watermill.NewUUID(), []byte(`{}`))
+
+	_, span, traced := tracer.startPublish("orders", msg)
+	endSpan(span, nil)
+
+	assert.False(t, span.SpanContext().IsValid())
+	assert.Empty(t, traced.Metadata.Get("traceparent"))
+}
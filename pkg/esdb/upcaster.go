@@ -0,0 +1,144 @@
+package esdb
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/EventStore/EventStore-Client-Go/v4/esdb"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// The version an event was stored with is kept in the metadata under this key once it was upcasted.
+const DefaultOriginalEventVersionKey = "_watermill_event_original_version"
+
+// Upcaster transforms the payload and the metadata of msg from the version it was registered for to the next one.
+// The event version in the metadata is bumped by UpcastingMarshaler, upcasters don't have to set it.
+type Upcaster func(msg *message.Message) error
+
+// UpcastingMarshaler decorates a Marshaler with a chain of upcasters applied on consume,
+// so handlers only see the latest shape of every event, even when old events are replayed.
+//
+// Upcasters are registered per event type and version; an event is transformed step by step
+// until there is no upcaster registered for its current version.
+// The zero value with Marshaler set is ready to use.
+type UpcastingMarshaler struct {
+	Marshaler Marshaler
+
+	// Metadata key the event type is read from. Defaults to DefaultEventTypeKey.
+	EventTypeKey string
+	// Metadata key the event version is read from and written to. Defaults to DefaultEventVersionKey.
+	EventVersionKey string
+	// Metadata key the original version is recorded under. Defaults to DefaultOriginalEventVersionKey.
+	OriginalEventVersionKey string
+
+	lock      sync.RWMutex
+	upcasters map[registeredEvent]Upcaster
+}
+
+func NewUpcastingMarshaler(marshaler Marshaler) *UpcastingMarshaler {
+	return &UpcastingMarshaler{
+		Marshaler: marshaler,
+		upcasters: map[registeredEvent]Upcaster{},
+	}
+}
+
+func (u *UpcastingMarshaler) eventTypeKey() string {
+	if u.EventTypeKey == "" {
+		return DefaultEventTypeKey
+	}
+
+	return u.EventTypeKey
+}
+
+func (u *UpcastingMarshaler) eventVersionKey() string {
+	if u.EventVersionKey == "" {
+		return DefaultEventVersionKey
+	}
+
+	return u.EventVersionKey
+}
+
+func (u *UpcastingMarshaler) originalEventVersionKey() string {
+	if u.OriginalEventVersionKey == "" {
+		return DefaultOriginalEventVersionKey
+	}
+
+	return u.OriginalEventVersionKey
+}
+
+// Register registers upcaster transforming eventType from fromVersion to fromVersion+1.
+func (u *UpcastingMarshaler) Register(eventType string, fromVersion int, upcaster Upcaster) error {
+	if eventType == "" {
+		return errors.New("event type is empty")
+	}
+	if fromVersion < 1 {
+		return fmt.Errorf("invalid version %d of event type %s", fromVersion, eventType)
+	}
+
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	if u.upcasters == nil {
+		u.upcasters = map[registeredEvent]Upcaster{}
+	}
+
+	key := registeredEvent{eventType, fromVersion}
+	if _, ok := u.upcasters[key]; ok {
+		return fmt.Errorf("upcaster for %s v%d is already registered", eventType, fromVersion)
+	}
+
+	u.upcasters[key] = upcaster
+	return nil
+}
+
+func (u *UpcastingMarshaler) upcaster(eventType string, version int) (Upcaster, bool) {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	upcaster, ok := u.upcasters[registeredEvent{eventType, version}]
+	return upcaster, ok
+}
+
+func (u *UpcastingMarshaler) Marshal(msg *message.Message) (esdb.EventData, error) {
+	return u.Marshaler.Marshal(msg)
+}
+
+func (u *UpcastingMarshaler) Unmarshal(event *esdb.ResolvedEvent) (*message.Message, error) {
+	m, err := u.Marshaler.Unmarshal(event)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.Metadata.Get(u.eventTypeKey()) == "" {
+		m.Metadata.Set(u.eventTypeKey(), event.Event.EventType)
+	}
+
+	originalVersion, err := messageEventVersion(m, u.eventVersionKey())
+	if err != nil {
+		return nil, err
+	}
+
+	version := originalVersion
+	for {
+		eventType := m.Metadata.Get(u.eventTypeKey())
+		upcaster, ok := u.upcaster(eventType, version)
+		if !ok {
+			break
+		}
+
+		if err := upcaster(m); err != nil {
+			return nil, fmt.Errorf("can't upcast %s v%d: %w", eventType, version, err)
+		}
+
+		version++
+		m.Metadata.Set(u.eventVersionKey(), strconv.Itoa(version))
+	}
+
+	if version != originalVersion && m.Metadata.Get(u.originalEventVersionKey()) == "" {
+		m.Metadata.Set(u.originalEventVersionKey(), strconv.Itoa(originalVersion))
+	}
+
+	return m, nil
+}
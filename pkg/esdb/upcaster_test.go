@@ -0,0 +1,112 @@
+package esdb_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/EventStore/EventStore-Client-Go/v4/esdb"
+	wesdb "github.com/KirylJazzSax/watermill-eventstore/pkg/esdb"
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func marshalToResolvedEvent(t *testing.T, marshaler wesdb.Marshaler, msg *message.Message) *esdb.ResolvedEvent {
+	t.Helper()
+
+	eventData, err := marshaler.Marshal(msg)
+	require.NoError(t, err)
+
+	contentType := wesdb.ContentTypeBinary
+	if eventData.ContentType == esdb.ContentTypeJson {
+		contentType = wesdb.ContentTypeJSON
+	}
+
+	return &esdb.ResolvedEvent{
+		Event: &esdb.RecordedEvent{
+			EventID:      eventData.EventID,
+			EventType:    eventData.EventType,
+			ContentType:  contentType,
+			UserMetadata: eventData.Metadata,
+			Data:         eventData.Data,
+		},
+	}
+}
+
+func TestUpcastingChain(t *testing.T) {
+	marshaler := wesdb.NewUpcastingMarshaler(wesdb.DefaultMarshaler{})
+	require.NoError(t, marshaler.Register("order_placed", 1, func(msg *message.Message) error {
+		msg.Payload = []byte(`{"order_id":"1","customer":"unknown"}`)
+		return nil
+	}))
+	require.NoError(t, marshaler.Register("order_placed", 2, func(msg *message.Message) error {
+		var event map[string]any
+		if err := json.Unmarshal(msg.Payload, &event); err != nil {
+			return err
+		}
+		event["channel"] = "web"
+		payload, err := json.Marshal(event)
+		msg.Payload = payload
+		return err
+	}))
+
+	oldMessage := message.NewMessage(watermill.NewUUID(), []byte(`{"order_id":"1"}`))
+	oldMessage.Metadata.Set(wesdb.DefaultEventTypeKey, "order_placed")
+
+	m, err := marshaler.Unmarshal(marshalToResolvedEvent(t, marshaler, oldMessage))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"order_id":"1","customer":"unknown","channel":"web"}`, string(m.Payload))
+	assert.Equal(t, "3", m.Metadata.Get(wesdb.DefaultEventVersionKey))
+	assert.Equal(t, "1", m.Metadata.Get(wesdb.DefaultOriginalEventVersionKey))
+}
+
+func TestUpcastingZeroValue(t *testing.T) {
+	marshaler := &wesdb.UpcastingMarshaler{Marshaler: wesdb.DefaultMarshaler{}}
+
+	oldMessage := message.NewMessage(watermill.NewUUID(), []byte(`{"order_id":"1"}`))
+	oldMessage.Metadata.Set(wesdb.DefaultEventTypeKey, "order_placed")
+	m, err := marshaler.Unmarshal(marshalToResolvedEvent(t, marshaler, oldMessage))
+	require.NoError(t, err, "nothing is registered yet")
+	assert.Empty(t, m.Metadata.Get(wesdb.DefaultOriginalEventVersionKey))
+
+	require.NoError(t, marshaler.Register("order_placed", 1, func(msg *message.Message) error {
+		msg.Payload = []byte(`{"order_id":"1","customer":"unknown"}`)
+		return nil
+	}))
+
+	m, err = marshaler.Unmarshal(marshalToResolvedEvent(t, marshaler, oldMessage))
+	require.NoError(t, err)
+	assert.Equal(t, "2", m.Metadata.Get(wesdb.DefaultEventVersionKey))
+}
+
+func TestUpcastingCurrentVersion(t *testing.T) {
+	marshaler := wesdb.NewUpcastingMarshaler(wesdb.DefaultMarshaler{})
+	require.NoError(t, marshaler.Register("order_placed", 1, func(msg *message.Message) error {
+		return errors.New("must not be called")
+	}))
+
+	currentMessage := message.NewMessage(watermill.NewUUID(), []byte(`{"order_id":"1"}`))
+	currentMessage.Metadata.Set(wesdb.DefaultEventTypeKey, "order_placed")
+	currentMessage.Metadata.Set(wesdb.DefaultEventVersionKey, "2")
+
+	m, err := marshaler.Unmarshal(marshalToResolvedEvent(t, marshaler, currentMessage))
+	require.NoError(t, err)
+	assert.Equal(t, "2", m.Metadata.Get(wesdb.DefaultEventVersionKey))
+	assert.Empty(t, m.Metadata.Get(wesdb.DefaultOriginalEventVersionKey))
+}
+
+func TestUpcastingFailure(t *testing.T) {
+	marshaler := wesdb.NewUpcastingMarshaler(wesdb.DefaultMarshaler{})
+	require.NoError(t, marshaler.Register("order_placed", 1, func(msg *message.Message) error {
+		return errors.New("broken event")
+	}))
+	assert.Error(t, marshaler.Register("order_placed", 1, func(msg *message.Message) error { return nil }))
+
+	oldMessage := message.NewMessage(watermill.NewUUID(), []byte(`{}`))
+	oldMessage.Metadata.Set(wesdb.DefaultEventTypeKey, "order_placed")
+
+	_, err := marshaler.Unmarshal(marshalToResolvedEvent(t, marshaler, oldMessage))
+	assert.Error(t, err)
+}
@@ -0,0 +1,160 @@
+package esdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/EventStore/EventStore-Client-Go/v4/esdb"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// SchemaValidationError is returned when a payload doesn't conform to the JSON Schema of its event type.
+type SchemaValidationError struct {
+	EventType string
+	// JSON pointer of the value failing validation, empty for the whole payload.
+	Pointer string
+	Message string
+	Err     error
+}
+
+func (e *SchemaValidationError) Error() string {
+	return fmt.Sprintf("%s payload doesn't match its schema at %q: %s", e.EventType, e.Pointer, e.Message)
+}
+
+func (e *SchemaValidationError) Unwrap() error {
+	return e.Err
+}
+
+// SchemaRegistry keeps JSON Schemas per event type.
+// The zero value is ready to use, and a nil *SchemaRegistry has no schemas.
+type SchemaRegistry struct {
+	lock    sync.RWMutex
+	schemas map[string]*jsonschema.Schema
+}
+
+func NewSchemaRegistry() *SchemaRegistry {
+	return &SchemaRegistry{
+		schemas: map[string]*jsonschema.Schema{},
+	}
+}
+
+// Register compiles schema and registers it for eventType.
+func (r *SchemaRegistry) Register(eventType string, schema []byte) error {
+	if eventType == "" {
+		return errors.New("event type is empty")
+	}
+
+	url := "esdb://schemas/" + eventType + ".json"
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource(url, bytes.NewReader(schema)); err != nil {
+		return fmt.Errorf("can't load schema of %s: %w", eventType, err)
+	}
+
+	compiled, err := compiler.Compile(url)
+	if err != nil {
+		return fmt.Errorf("can't compile schema of %s: %w", eventType, err)
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.schemas == nil {
+		r.schemas = map[string]*jsonschema.Schema{}
+	}
+	r.schemas[eventType] = compiled
+	return nil
+}
+
+// Validate validates payload against the schema of eventType.
+// Payloads of event types without a schema are always valid.
+func (r *SchemaRegistry) Validate(eventType string, payload []byte) error {
+	if r == nil {
+		return nil
+	}
+
+	r.lock.RLock()
+	schema, ok := r.schemas[eventType]
+	r.lock.RUnlock()
+
+	if !ok {
+		return nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return &SchemaValidationError{
+			EventType: eventType,
+			Message:   "payload is not valid JSON",
+			Err:       err,
+		}
+	}
+
+	err := schema.Validate(value)
+	if err == nil {
+		return nil
+	}
+
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		return fmt.Errorf("can't validate %s payload: %w", eventType, err)
+	}
+
+	cause := leafValidationError(validationErr)
+	return &SchemaValidationError{
+		EventType: eventType,
+		Pointer:   cause.InstanceLocation,
+		Message:   cause.Message,
+		Err:       err,
+	}
+}
+
+func leafValidationError(err *jsonschema.ValidationError) *jsonschema.ValidationError {
+	for len(err.Causes) > 0 {
+		err = err.Causes[0]
+	}
+
+	return err
+}
+
+// ValidatingMarshaler decorates a Marshaler and validates payloads against the JSON Schemas registered for their event types.
+//
+// Invalid messages fail Marshal, so the Publisher rejects them before they are appended to the stream.
+// Invalid events fail Unmarshal, so the Subscriber handles them as events it couldn't unmarshal.
+// Without Schemas, every payload is valid.
+type ValidatingMarshaler struct {
+	Marshaler Marshaler
+	Schemas   *SchemaRegistry
+}
+
+func (v ValidatingMarshaler) Marshal(msg *message.Message) (esdb.EventData, error) {
+	eventData, err := v.Marshaler.Marshal(msg)
+	if err != nil {
+		return esdb.EventData{}, err
+	}
+
+	if err := v.Schemas.Validate(eventData.EventType, msg.Payload); err != nil {
+		return esdb.EventData{}, err
+	}
+
+	return eventData, nil
+}
+
+func (v ValidatingMarshaler) Unmarshal(event *esdb.ResolvedEvent) (*message.Message, error) {
+	m, err := v.Marshaler.Unmarshal(event)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := v.Schemas.Validate(event.Event.EventType, m.Payload); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
@@ -0,0 +1,106 @@
+package esdb_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/EventStore/EventStore-Client-Go/v4/esdb"
+	wesdb "github.com/KirylJazzSax/watermill-eventstore/pkg/esdb"
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const orderPlacedSchema = `{
+	"type": "object",
+	"required": ["order_id", "items"],
+	"properties": {
+		"order_id": {"type": "string"},
+		"items": {
+			"type": "array",
+			"items": {
+				"type": "object",
+				"properties": {"quantity": {"type": "integer", "minimum": 1}}
+			}
+		}
+	}
+}`
+
+func newValidatingMarshaler(t *testing.T) wesdb.ValidatingMarshaler {
+	schemas := wesdb.NewSchemaRegistry()
+	require.NoError(t, schemas.Register("order_placed", []byte(orderPlacedSchema)))
+
+	return wesdb.ValidatingMarshaler{
+		Marshaler: wesdb.DefaultMarshaler{},
+		Schemas:   schemas,
+	}
+}
+
+func TestValidationOnMarshal(t *testing.T) {
+	marshaler := newValidatingMarshaler(t)
+
+	valid := message.NewMessage(watermill.NewUUID(), []byte(`{"order_id":"1","items":[{"quantity":1}]}`))
+	valid.Metadata.Set(wesdb.DefaultEventTypeKey, "order_placed")
+	_, err := marshaler.Marshal(valid)
+	require.NoError(t, err)
+
+	invalid := message.NewMessage(watermill.NewUUID(), []byte(`{"order_id":"1","items":[{"quantity":0}]}`))
+	invalid.Metadata.Set(wesdb.DefaultEventTypeKey, "order_placed")
+	_, err = marshaler.Marshal(invalid)
+
+	var validationErr *wesdb.SchemaValidationError
+	require.True(t, errors.As(err, &validationErr))
+	assert.Equal(t, "order_placed", validationErr.EventType)
+	assert.Equal(t, "/items/0/quantity", validationErr.Pointer)
+}
+
+func TestValidationOnUnmarshal(t *testing.T) {
+	marshaler := newValidatingMarshaler(t)
+
+	invalid := message.NewMessage(watermill.NewUUID(), []byte(`{"items":[]}`))
+	invalid.Metadata.Set(wesdb.DefaultEventTypeKey, "order_placed")
+	event := marshalToResolvedEvent(t, wesdb.DefaultMarshaler{}, invalid)
+
+	_, err := marshaler.Unmarshal(event)
+
+	var validationErr *wesdb.SchemaValidationError
+	require.True(t, errors.As(err, &validationErr))
+	assert.Equal(t, "order_placed", validationErr.EventType)
+}
+
+func TestValidationSkipsUnregisteredTypes(t *testing.T) {
+	marshaler := newValidatingMarshaler(t)
+
+	m := message.NewMessage(watermill.NewUUID(), []byte(`not json`))
+	eventData, err := marshaler.Marshal(m)
+	require.NoError(t, err)
+	assert.Equal(t, esdb.ContentTypeBinary, eventData.ContentType)
+}
+
+func TestSchemaRegistryZeroValue(t *testing.T) {
+	var schemas wesdb.SchemaRegistry
+	require.NoError(t, schemas.Register("order_placed", []byte(orderPlacedSchema)))
+
+	assert.Error(t, schemas.Validate("order_placed", []byte(`{"items":[]}`)))
+	assert.NoError(t, schemas.Validate("order_placed", []byte(`{"order_id":"1","items":[]}`)))
+}
+
+func TestValidationWithoutSchemas(t *testing.T) {
+	marshaler := wesdb.ValidatingMarshaler{Marshaler: wesdb.DefaultMarshaler{}}
+
+	m := message.NewMessage(watermill.NewUUID(), []byte(`{"items":[]}`))
+	m.Metadata.Set(wesdb.DefaultEventTypeKey, "order_placed")
+	eventData, err := marshaler.Marshal(m)
+	require.NoError(t, err, "nil schemas validate nothing")
+
+	_, err = marshaler.Unmarshal(marshalToResolvedEvent(t, wesdb.DefaultMarshaler{}, m))
+	require.NoError(t, err)
+	assert.Equal(t, "order_placed", eventData.EventType)
+}
+
+func TestValidationInvalidSchema(t *testing.T) {
+	schemas := wesdb.NewSchemaRegistry()
+
+	assert.Error(t, schemas.Register("order_placed", []byte(`{"type": 5}`)))
+}
@@ -0,0 +1,84 @@
+package eventsourcing
+
+import (
+	"github.com/EventStore/EventStore-Client-Go/v4/esdb"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// Aggregate is an event-sourced aggregate.
+// Embed Root to implement everything but Apply.
+type Aggregate interface {
+	// Apply changes the state of the aggregate by event.
+	// It's called with values of registered event types, both for loaded events and events passed to Raise.
+	Apply(event any) error
+	// Record adds event to the pending events without applying it. Raise applies and records events.
+	Record(event any)
+	// PendingEvents returns events raised since the aggregate was loaded or saved.
+	PendingEvents() []any
+	// ClearPendingEvents is called after pending events are saved.
+	ClearPendingEvents()
+	// Revision returns the revision of the aggregate stream the aggregate was loaded or saved at,
+	// or esdb.NoStream{} for a new aggregate.
+	Revision() esdb.ExpectedRevision
+	// SetRevision is called with the revision of the last event loaded or saved.
+	SetRevision(revision uint64)
+}
+
+// MetadataProvider is implemented by aggregates whose events and snapshots carry metadata.
+// For example, returning the subject ID under esdb.DefaultEncryptionSubjectKey makes EncryptingMarshaler encrypt them,
+// so the personal data in them is erased with the subject's keys.
+type MetadataProvider interface {
+	// EventMetadata returns the metadata copied to every saved event and snapshot of the aggregate.
+	EventMetadata() message.Metadata
+}
+
+// aggregateMetadata returns the metadata of aggregate, or nil when it doesn't implement MetadataProvider.
+func aggregateMetadata(aggregate Aggregate) message.Metadata {
+	if provider, ok := aggregate.(MetadataProvider); ok {
+		return provider.EventMetadata()
+	}
+
+	return nil
+}
+
+// Root keeps the pending events and the revision of an aggregate. Its zero value is a new aggregate.
+type Root struct {
+	pending     []any
+	revision    uint64
+	hasRevision bool
+}
+
+func (r *Root) Record(event any) {
+	r.pending = append(r.pending, event)
+}
+
+func (r *Root) PendingEvents() []any {
+	return r.pending
+}
+
+func (r *Root) ClearPendingEvents() {
+	r.pending = nil
+}
+
+func (r *Root) Revision() esdb.ExpectedRevision {
+	if !r.hasRevision {
+		return esdb.NoStream{}
+	}
+
+	return esdb.Revision(r.revision)
+}
+
+func (r *Root) SetRevision(revision uint64) {
+	r.revision = revision
+	r.hasRevision = true
+}
+
+// Raise applies event to aggregate and adds it to its pending events, which are appended on Repository.Save.
+func Raise(aggregate Aggregate, event any) error {
+	if err := aggregate.Apply(event); err != nil {
+		return err
+	}
+
+	aggregate.Record(event)
+	return nil
+}
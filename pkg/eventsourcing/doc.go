@@ -0,0 +1,10 @@
+// Event-sourced aggregates stored in EventStoreDB streams.
+//
+// Repository loads an aggregate by reading its stream with esdb.Reader and applying decoded events,
+// and saves its pending events with esdb.Publisher, expecting the stream to be at the loaded revision.
+// Events are encoded with esdb.EventRegistry and stored by Config.Marshaler, like published messages.
+// Aggregates implementing MetadataProvider add metadata to them, like the subject ID used by EncryptingMarshaler.
+//
+// Repository.WithSnapshots makes loading start from the latest snapshot of the aggregate, taken according to a SnapshotPolicy.
+// StreamSnapshotStore keeps it in the stream "snapshot-<stream>" with $maxCount=1, written by the same Marshaler.
+package eventsourcing
@@ -0,0 +1,247 @@
+package eventsourcing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"reflect"
+	"strconv"
+
+	"github.com/EventStore/EventStore-Client-Go/v4/esdb"
+	wesdb "github.com/KirylJazzSax/watermill-eventstore/pkg/esdb"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+var (
+	// ErrAggregateNotFound is returned by Repository.Load when the aggregate stream has no events.
+	ErrAggregateNotFound = errors.New("aggregate not found")
+	// ErrConcurrencyConflict is returned by Repository.Save when the aggregate stream changed since the aggregate was loaded.
+	ErrConcurrencyConflict = errors.New("aggregate was changed concurrently")
+)
+
+// EventStore reads and appends aggregate streams. Store implements it with esdb.Reader and esdb.Publisher.
+type EventStore interface {
+	// Read reads the messages of stream, with their revision under wesdb.RevisionKey.
+	Read(ctx context.Context, stream string, options wesdb.ReadOptions) iter.Seq2[*message.Message, error]
+	// Append appends messages to stream in a single write, if the stream is at expectedRevision.
+	// It returns the revision of the last appended event, or an error wrapping wesdb.ErrWrongExpectedVersion.
+	Append(ctx context.Context, stream string, expectedRevision esdb.ExpectedRevision, messages ...*message.Message) (uint64, error)
+}
+
+// Store is the EventStore of a Reader and a Publisher, which should use the same Config.Marshaler.
+type Store struct {
+	*wesdb.Reader
+	*wesdb.Publisher
+}
+
+var _ EventStore = Store{}
+
+// Close closes the Reader and the Publisher of the store.
+func (s Store) Close() error {
+	var readerErr, publisherErr error
+	if s.Reader != nil {
+		readerErr = s.Reader.Close()
+	}
+	if s.Publisher != nil {
+		publisherErr = s.Publisher.Close()
+	}
+
+	return errors.Join(readerErr, publisherErr)
+}
+
+// Repository loads and saves aggregates of type T. Each aggregate is stored in the stream "<category>-<id>".
+type Repository[T Aggregate] struct {
+	store        EventStore
+	events       *wesdb.EventRegistry
+	category     string
+	newAggregate func() T
+
+	snapshots      SnapshotStore
+	snapshotPolicy SnapshotPolicy
+}
+
+// NewRepository creates a Repository storing aggregates in store.
+// Their events are encoded with events, and newAggregate returns an aggregate without any events applied.
+func NewRepository[T Aggregate](store EventStore, events *wesdb.EventRegistry, category string, newAggregate func() T) *Repository[T] {
+	return &Repository[T]{
+		store:        store,
+		events:       events,
+		category:     category,
+		newAggregate: newAggregate,
+	}
+}
+
+// WithSnapshots returns a copy of the repository which loads aggregates from their latest snapshot in snapshots,
+// and takes a snapshot after saving when policy says so. A nil policy is EveryNEvents(DefaultSnapshotInterval).
+//
+// Aggregates are snapshotted as JSON, so their state has to be in exported fields, or they have to implement
+// json.Marshaler and json.Unmarshaler. Snapshots which can't be decoded, for example after the aggregate changed,
+// are ignored and the whole stream is read.
+func (r *Repository[T]) WithSnapshots(snapshots SnapshotStore, policy SnapshotPolicy) *Repository[T] {
+	if policy == nil {
+		policy = EveryNEvents(DefaultSnapshotInterval)
+	}
+
+	withSnapshots := *r
+	withSnapshots.snapshots = snapshots
+	withSnapshots.snapshotPolicy = policy
+	return &withSnapshots
+}
+
+// Stream returns the name of the stream of the aggregate with id.
+func (r *Repository[T]) Stream(id string) string {
+	return r.category + "-" + id
+}
+
+// Load reads the stream of the aggregate with id and applies its events to a new aggregate,
+// or to the aggregate restored from its latest snapshot, if there is one.
+// It returns ErrAggregateNotFound when the stream has no events.
+func (r *Repository[T]) Load(ctx context.Context, id string) (T, error) {
+	aggregate, from, err := r.loadSnapshot(ctx, r.Stream(id))
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+
+	loaded, err := r.apply(ctx, aggregate, r.Stream(id), from)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	if !loaded && from == (esdb.Start{}) {
+		var zero T
+		return zero, fmt.Errorf("%w: %s", ErrAggregateNotFound, r.Stream(id))
+	}
+
+	return aggregate, nil
+}
+
+// loadSnapshot returns the aggregate restored from the latest snapshot of stream and the revision following it,
+// or a new aggregate and esdb.Start{} when there is no usable snapshot.
+func (r *Repository[T]) loadSnapshot(ctx context.Context, stream string) (T, esdb.StreamPosition, error) {
+	if r.snapshots == nil {
+		return r.newAggregate(), esdb.Start{}, nil
+	}
+
+	snapshot, err := r.snapshots.LoadSnapshot(ctx, stream)
+	if err != nil {
+		var zero T
+		return zero, nil, fmt.Errorf("can't load snapshot of %s: %w", stream, err)
+	}
+	if snapshot == nil {
+		return r.newAggregate(), esdb.Start{}, nil
+	}
+
+	aggregate := r.newAggregate()
+	if err := json.Unmarshal(snapshot.Data, aggregate); err != nil {
+		return r.newAggregate(), esdb.Start{}, nil
+	}
+	aggregate.SetRevision(snapshot.Revision)
+
+	return aggregate, esdb.Revision(snapshot.Revision + 1), nil
+}
+
+// apply applies the events of stream from revision to aggregate. It reports whether any event was applied.
+func (r *Repository[T]) apply(ctx context.Context, aggregate T, stream string, from esdb.StreamPosition) (bool, error) {
+	applied := false
+	for m, err := range r.store.Read(ctx, stream, wesdb.ReadOptions{From: from}) {
+		if err != nil {
+			if wesdb.IsNotFound(err) {
+				return applied, nil
+			}
+			return applied, err
+		}
+
+		revision, err := strconv.ParseUint(m.Metadata.Get(wesdb.RevisionKey), 10, 64)
+		if err != nil {
+			return applied, fmt.Errorf("invalid revision of message %s: %w", m.UUID, err)
+		}
+
+		event, err := r.events.Decode(m)
+		if err != nil {
+			return applied, fmt.Errorf("can't decode event %d of %s: %w", revision, stream, err)
+		}
+		// Events are applied as values of the registered types, like the ones passed to Raise.
+		if err := aggregate.Apply(reflect.ValueOf(event).Elem().Interface()); err != nil {
+			return applied, fmt.Errorf("can't apply event %d of %s: %w", revision, stream, err)
+		}
+
+		aggregate.SetRevision(revision)
+		applied = true
+	}
+
+	return applied, nil
+}
+
+// Save appends the pending events of the aggregate with id, expecting its stream to be at the revision it was loaded at.
+// It returns ErrConcurrencyConflict when the stream changed in the meantime; the aggregate should be loaded again then.
+//
+// Events carry the metadata of aggregates implementing MetadataProvider.
+//
+// When the snapshot policy says so, a snapshot is taken after the events are saved.
+// Failing to take it doesn't undo the save: the returned error wraps ErrSnapshotFailed and the events shouldn't be saved again.
+func (r *Repository[T]) Save(ctx context.Context, id string, aggregate T) error {
+	pending := aggregate.PendingEvents()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	metadata := aggregateMetadata(aggregate)
+	messages := make([]*message.Message, 0, len(pending))
+	for _, event := range pending {
+		m, err := r.events.NewMessage(event)
+		if err != nil {
+			return err
+		}
+		for key, value := range metadata {
+			m.Metadata.Set(key, value)
+		}
+		m.SetContext(ctx)
+		messages = append(messages, m)
+	}
+
+	expectedRevision := aggregate.Revision()
+	revision, err := r.store.Append(ctx, r.Stream(id), expectedRevision, messages...)
+	if errors.Is(err, wesdb.ErrWrongExpectedVersion) {
+		return fmt.Errorf("%w: %w", ErrConcurrencyConflict, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	aggregate.SetRevision(revision)
+	aggregate.ClearPendingEvents()
+
+	if r.snapshots == nil || !r.snapshotPolicy(streamLength(expectedRevision), revision+1) {
+		return nil
+	}
+	if err := r.saveSnapshot(ctx, r.Stream(id), aggregate, revision); err != nil {
+		return fmt.Errorf("%w: %w", ErrSnapshotFailed, err)
+	}
+
+	return nil
+}
+
+func (r *Repository[T]) saveSnapshot(ctx context.Context, stream string, aggregate T, revision uint64) error {
+	data, err := json.Marshal(aggregate)
+	if err != nil {
+		return fmt.Errorf("can't encode snapshot of %s: %w", stream, err)
+	}
+
+	return r.snapshots.SaveSnapshot(ctx, stream, Snapshot{
+		Revision: revision,
+		Data:     data,
+		Metadata: aggregateMetadata(aggregate),
+	})
+}
+
+// streamLength returns the number of events in a stream at revision.
+func streamLength(revision esdb.ExpectedRevision) uint64 {
+	if streamRevision, ok := revision.(esdb.StreamRevision); ok {
+		return streamRevision.Value + 1
+	}
+
+	return 0
+}
@@ -0,0 +1,286 @@
+package eventsourcing_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/EventStore/EventStore-Client-Go/v4/esdb"
+	wesdb "github.com/KirylJazzSax/watermill-eventstore/pkg/esdb"
+	"github.com/KirylJazzSax/watermill-eventstore/pkg/eventsourcing"
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type OrderPlaced struct {
+	ID string `json:"id"`
+}
+
+type ItemAdded struct {
+	SKU string `json:"sku"`
+}
+
+type Order struct {
+	eventsourcing.Root
+
+	ID    string
+	Items []string
+}
+
+func (o *Order) Apply(event any) error {
+	switch e := event.(type) {
+	case OrderPlaced:
+		o.ID = e.ID
+	case ItemAdded:
+		if o.ID == "" {
+			return errors.New("order isn't placed")
+		}
+		o.Items = append(o.Items, e.SKU)
+	default:
+		return fmt.Errorf("unknown event %T", event)
+	}
+
+	return nil
+}
+
+// memoryStore is an in-memory EventStore.
+type memoryStore struct {
+	lock     sync.Mutex
+	streams  map[string][]*message.Message
+	metadata map[string]esdb.StreamMetadata
+	// metadataErr is returned by SetStreamMetadata when set.
+	metadataErr  error
+	metadataSets int
+	reads        []wesdb.ReadOptions
+}
+
+func (s *memoryStore) Read(_ context.Context, stream string, options wesdb.ReadOptions) iter.Seq2[*message.Message, error] {
+	s.lock.Lock()
+	messages := append([]*message.Message(nil), s.streams[stream]...)
+	s.reads = append(s.reads, options)
+	s.lock.Unlock()
+
+	if from, ok := options.From.(esdb.StreamRevision); ok {
+		messages = messages[min(from.Value, uint64(len(messages))):]
+	}
+	if options.Direction == esdb.Backwards {
+		slices.Reverse(messages)
+	}
+	if options.MaxCount > 0 && uint64(len(messages)) > options.MaxCount {
+		messages = messages[:options.MaxCount]
+	}
+
+	return func(yield func(*message.Message, error) bool) {
+		for _, m := range messages {
+			if !yield(m, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (s *memoryStore) StreamMetadata(_ context.Context, stream string) (esdb.StreamMetadata, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.metadata[stream], nil
+}
+
+func (s *memoryStore) SetStreamMetadata(_ context.Context, stream string, metadata esdb.StreamMetadata) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.metadataSets++
+	if s.metadataErr != nil {
+		return s.metadataErr
+	}
+
+	if s.metadata == nil {
+		s.metadata = map[string]esdb.StreamMetadata{}
+	}
+	s.metadata[stream] = metadata
+	return nil
+}
+
+func (s *memoryStore) Append(_ context.Context, stream string, expectedRevision esdb.ExpectedRevision, messages ...*message.Message) (uint64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	current := len(s.streams[stream])
+	switch expected := expectedRevision.(type) {
+	case esdb.NoStream:
+		if current > 0 {
+			return 0, wesdb.ErrWrongExpectedVersion
+		}
+	case esdb.StreamRevision:
+		if uint64(current) != expected.Value+1 {
+			return 0, wesdb.ErrWrongExpectedVersion
+		}
+	}
+
+	if s.streams == nil {
+		s.streams = map[string][]*message.Message{}
+	}
+	for i, m := range messages {
+		m = m.Copy()
+		m.Metadata.Set(wesdb.RevisionKey, strconv.Itoa(current+i))
+		s.streams[stream] = append(s.streams[stream], m)
+	}
+
+	return uint64(len(s.streams[stream]) - 1), nil
+}
+
+func newTestRepository(store eventsourcing.EventStore) *eventsourcing.Repository[*Order] {
+	events := wesdb.NewEventRegistry()
+	events.MustRegister("OrderPlaced", 1, OrderPlaced{})
+	events.MustRegister("ItemAdded", 1, ItemAdded{})
+
+	return eventsourcing.NewRepository(store, events, "order", func() *Order {
+		return &Order{}
+	})
+}
+
+func TestRepositorySaveAndLoad(t *testing.T) {
+	store := &memoryStore{}
+	repository := newTestRepository(store)
+	ctx := context.Background()
+
+	order := &Order{}
+	require.NoError(t, eventsourcing.Raise(order, OrderPlaced{ID: "1"}))
+	require.NoError(t, eventsourcing.Raise(order, ItemAdded{SKU: "apple"}))
+	assert.Len(t, order.PendingEvents(), 2)
+
+	require.NoError(t, repository.Save(ctx, "1", order))
+	assert.Empty(t, order.PendingEvents())
+	assert.Equal(t, esdb.Revision(1), order.Revision())
+	assert.Len(t, store.streams["order-1"], 2)
+
+	loaded, err := repository.Load(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, "1", loaded.ID)
+	assert.Equal(t, []string{"apple"}, loaded.Items)
+	assert.Equal(t, esdb.Revision(1), loaded.Revision())
+	assert.Empty(t, loaded.PendingEvents())
+
+	require.NoError(t, eventsourcing.Raise(loaded, ItemAdded{SKU: "pear"}))
+	require.NoError(t, repository.Save(ctx, "1", loaded))
+
+	loaded, err = repository.Load(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"apple", "pear"}, loaded.Items)
+	assert.Equal(t, esdb.Revision(2), loaded.Revision())
+}
+
+func TestRepositoryLoadNotFound(t *testing.T) {
+	repository := newTestRepository(&memoryStore{})
+
+	_, err := repository.Load(context.Background(), "1")
+	assert.ErrorIs(t, err, eventsourcing.ErrAggregateNotFound)
+}
+
+func TestRepositorySaveConcurrencyConflict(t *testing.T) {
+	store := &memoryStore{}
+	repository := newTestRepository(store)
+	ctx := context.Background()
+
+	order := &Order{}
+	require.NoError(t, eventsourcing.Raise(order, OrderPlaced{ID: "1"}))
+	require.NoError(t, repository.Save(ctx, "1", order))
+
+	first, err := repository.Load(ctx, "1")
+	require.NoError(t, err)
+	second, err := repository.Load(ctx, "1")
+	require.NoError(t, err)
+
+	require.NoError(t, eventsourcing.Raise(first, ItemAdded{SKU: "apple"}))
+	require.NoError(t, repository.Save(ctx, "1", first))
+
+	require.NoError(t, eventsourcing.Raise(second, ItemAdded{SKU: "pear"}))
+	err = repository.Save(ctx, "1", second)
+	assert.ErrorIs(t, err, eventsourcing.ErrConcurrencyConflict)
+	assert.ErrorIs(t, err, wesdb.ErrWrongExpectedVersion)
+	assert.Len(t, second.PendingEvents(), 1, "pending events are kept when saving fails")
+	assert.Len(t, store.streams["order-1"], 2)
+}
+
+func TestRepositorySaveNewAggregateConflict(t *testing.T) {
+	repository := newTestRepository(&memoryStore{})
+	ctx := context.Background()
+
+	for i, sku := range []string{"apple", "pear"} {
+		order := &Order{}
+		require.NoError(t, eventsourcing.Raise(order, OrderPlaced{ID: "1"}))
+		require.NoError(t, eventsourcing.Raise(order, ItemAdded{SKU: sku}))
+
+		err := repository.Save(ctx, "1", order)
+		if i == 0 {
+			require.NoError(t, err)
+		} else {
+			assert.ErrorIs(t, err, eventsourcing.ErrConcurrencyConflict, "a new aggregate expects no stream")
+		}
+	}
+}
+
+func TestRaiseApplyError(t *testing.T) {
+	order := &Order{}
+
+	assert.Error(t, eventsourcing.Raise(order, ItemAdded{SKU: "apple"}))
+	assert.Empty(t, order.PendingEvents(), "events which can't be applied aren't recorded")
+}
+
+func TestRepositoryLoadUnregisteredEvent(t *testing.T) {
+	store := &memoryStore{}
+	repository := newTestRepository(store)
+
+	m := message.NewMessage("1", []byte(`{}`))
+	m.Metadata.Set(wesdb.DefaultEventTypeKey, "OrderCancelled")
+	_, err := store.Append(context.Background(), repository.Stream("1"), esdb.NoStream{}, m)
+	require.NoError(t, err)
+
+	_, err = repository.Load(context.Background(), "1")
+	assert.ErrorContains(t, err, "can't decode event 0 of order-1")
+}
+
+// counter implements Aggregate without embedding Root.
+type counter struct {
+	count   int
+	pending []any
+}
+
+func (c *counter) Apply(any) error {
+	c.count++
+	return nil
+}
+
+func (c *counter) Record(event any)                { c.pending = append(c.pending, event) }
+func (c *counter) PendingEvents() []any            { return c.pending }
+func (c *counter) ClearPendingEvents()             { c.pending = nil }
+func (c *counter) Revision() esdb.ExpectedRevision { return esdb.NoStream{} }
+func (c *counter) SetRevision(uint64)              {}
+
+func TestRaiseWithoutRoot(t *testing.T) {
+	c := &counter{}
+
+	require.NoError(t, eventsourcing.Raise(c, ItemAdded{SKU: "apple"}))
+	assert.Equal(t, 1, c.count)
+	assert.Equal(t, []any{ItemAdded{SKU: "apple"}}, c.PendingEvents())
+}
+
+func TestStoreClose(t *testing.T) {
+	assert.NoError(t, eventsourcing.Store{}.Close(), "a missing reader or publisher isn't closed")
+
+	config := wesdb.Config{ConnectionString: "esdb://localhost:2113?tls=false"}
+	reader, err := wesdb.NewReader(config, watermill.NopLogger{})
+	require.NoError(t, err)
+	publisher, err := wesdb.NewPublisher(config, watermill.NopLogger{})
+	require.NoError(t, err)
+
+	assert.NoError(t, eventsourcing.Store{Reader: reader, Publisher: publisher}.Close())
+}
@@ -0,0 +1,140 @@
+package eventsourcing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/EventStore/EventStore-Client-Go/v4/esdb"
+	wesdb "github.com/KirylJazzSax/watermill-eventstore/pkg/esdb"
+	"github.com/ThreeDotsLabs/watermill"
+	"github.com/ThreeDotsLabs/watermill/message"
+)
+
+// DefaultSnapshotInterval is the number of events between snapshots when Repository.WithSnapshots is given no policy.
+const DefaultSnapshotInterval = 100
+
+// SnapshotRevisionKey is the metadata key of the aggregate stream revision a snapshot was taken at.
+const SnapshotRevisionKey = "_esdb_snapshot_revision"
+
+// ErrSnapshotFailed is wrapped by errors of Repository.Save when events were saved, but taking a snapshot failed.
+var ErrSnapshotFailed = errors.New("snapshot failed")
+
+// Snapshot is the state of an aggregate at a revision of its stream.
+type Snapshot struct {
+	// Revision of the last event applied to the aggregate.
+	Revision uint64
+	// Data is the JSON encoded aggregate.
+	Data []byte
+	// Metadata of the aggregate, see MetadataProvider. It's stored with the snapshot, but not loaded.
+	Metadata message.Metadata
+}
+
+// SnapshotStore stores the latest snapshot of aggregate streams.
+type SnapshotStore interface {
+	// LoadSnapshot returns the latest snapshot of stream, or nil when there is none.
+	LoadSnapshot(ctx context.Context, stream string) (*Snapshot, error)
+	SaveSnapshot(ctx context.Context, stream string, snapshot Snapshot) error
+}
+
+// SnapshotPolicy reports whether to take a snapshot after a save grew the aggregate stream from before to after events.
+type SnapshotPolicy func(before, after uint64) bool
+
+// EveryNEvents takes a snapshot whenever the aggregate stream grows past a multiple of n events.
+func EveryNEvents(n uint64) SnapshotPolicy {
+	return func(before, after uint64) bool {
+		return n > 0 && after/n > before/n
+	}
+}
+
+// SnapshotEventStore is an EventStore which can set stream metadata, like Store.
+type SnapshotEventStore interface {
+	EventStore
+	StreamMetadata(ctx context.Context, stream string) (esdb.StreamMetadata, error)
+	SetStreamMetadata(ctx context.Context, stream string, metadata esdb.StreamMetadata) error
+}
+
+// StreamSnapshotStore stores snapshots in the companion stream "snapshot-<stream>" with $maxCount=1,
+// so only the latest snapshot is kept. Snapshots are written and read with the Config.Marshaler of store,
+// with the snapshot metadata. So they're compressed like events, and encrypted by EncryptingMarshaler
+// when the aggregate provides a subject ID, see MetadataProvider.
+type StreamSnapshotStore struct {
+	store SnapshotEventStore
+	// limited holds the snapshot streams which are known to have $maxCount=1.
+	limited sync.Map
+}
+
+func NewStreamSnapshotStore(store SnapshotEventStore) *StreamSnapshotStore {
+	return &StreamSnapshotStore{store: store}
+}
+
+// SnapshotStream returns the name of the stream with snapshots of stream.
+func SnapshotStream(stream string) string {
+	return "snapshot-" + stream
+}
+
+func (s *StreamSnapshotStore) LoadSnapshot(ctx context.Context, stream string) (*Snapshot, error) {
+	snapshotStream := SnapshotStream(stream)
+
+	for m, err := range s.store.Read(ctx, snapshotStream, wesdb.ReadOptions{Direction: esdb.Backwards, MaxCount: 1}) {
+		if err != nil {
+			if wesdb.IsNotFound(err) {
+				return nil, nil
+			}
+			return nil, err
+		}
+
+		revision, err := strconv.ParseUint(m.Metadata.Get(SnapshotRevisionKey), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid revision of snapshot %s in %s: %w", m.UUID, snapshotStream, err)
+		}
+
+		return &Snapshot{Revision: revision, Data: m.Payload}, nil
+	}
+
+	return nil, nil
+}
+
+func (s *StreamSnapshotStore) SaveSnapshot(ctx context.Context, stream string, snapshot Snapshot) error {
+	snapshotStream := SnapshotStream(stream)
+
+	m := message.NewMessage(watermill.NewUUID(), snapshot.Data)
+	for key, value := range snapshot.Metadata {
+		m.Metadata.Set(key, value)
+	}
+	m.Metadata.Set(SnapshotRevisionKey, strconv.FormatUint(snapshot.Revision, 10))
+	m.SetContext(ctx)
+
+	if _, err := s.store.Append(ctx, snapshotStream, esdb.Any{}, m); err != nil {
+		return err
+	}
+
+	if _, ok := s.limited.Load(snapshotStream); ok {
+		return nil
+	}
+	if err := s.limitStream(ctx, snapshotStream); err != nil {
+		return fmt.Errorf("can't set $maxCount of %s: %w", snapshotStream, err)
+	}
+	s.limited.Store(snapshotStream, struct{}{})
+
+	return nil
+}
+
+// limitStream sets $maxCount=1 of snapshotStream, unless it's set already.
+// It's checked after every snapshot until it succeeds, so a failure is retried with the next snapshot.
+func (s *StreamSnapshotStore) limitStream(ctx context.Context, snapshotStream string) error {
+	metadata, err := s.store.StreamMetadata(ctx, snapshotStream)
+	if err != nil {
+		return err
+	}
+	if maxCount := metadata.MaxCount(); maxCount != nil && *maxCount == 1 {
+		return nil
+	}
+
+	metadata.SetMaxCount(1)
+	return s.store.SetStreamMetadata(ctx, snapshotStream, metadata)
+}
+
+var _ SnapshotEventStore = Store{}
@@ -0,0 +1,231 @@
+package eventsourcing_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/EventStore/EventStore-Client-Go/v4/esdb"
+	wesdb "github.com/KirylJazzSax/watermill-eventstore/pkg/esdb"
+	"github.com/KirylJazzSax/watermill-eventstore/pkg/eventsourcing"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEveryNEvents(t *testing.T) {
+	testCases := []struct {
+		before   uint64
+		after    uint64
+		expected bool
+	}{
+		{before: 0, after: 2, expected: false},
+		{before: 0, after: 3, expected: true},
+		{before: 2, after: 4, expected: true},
+		{before: 3, after: 5, expected: false},
+		{before: 5, after: 12, expected: true},
+	}
+
+	policy := eventsourcing.EveryNEvents(3)
+	for _, tc := range testCases {
+		t.Run(strconv.FormatUint(tc.before, 10)+"-"+strconv.FormatUint(tc.after, 10), func(t *testing.T) {
+			assert.Equal(t, tc.expected, policy(tc.before, tc.after))
+		})
+	}
+
+	assert.False(t, eventsourcing.EveryNEvents(0)(0, 10))
+}
+
+// addItems raises n ItemAdded events and saves them.
+func addItems(t *testing.T, repository *eventsourcing.Repository[*Order], order *Order, n int) {
+	t.Helper()
+
+	for i := 0; i < n; i++ {
+		require.NoError(t, eventsourcing.Raise(order, ItemAdded{SKU: "item-" + strconv.Itoa(len(order.Items))}))
+	}
+	require.NoError(t, repository.Save(context.Background(), order.ID, order))
+}
+
+func TestRepositoryLoadsFromSnapshot(t *testing.T) {
+	store := &memoryStore{}
+	repository := newTestRepository(store).WithSnapshots(eventsourcing.NewStreamSnapshotStore(store), eventsourcing.EveryNEvents(3))
+	ctx := context.Background()
+
+	order := &Order{}
+	require.NoError(t, eventsourcing.Raise(order, OrderPlaced{ID: "1"}))
+	addItems(t, repository, order, 1)
+	assert.Empty(t, store.streams["snapshot-order-1"])
+
+	addItems(t, repository, order, 2)
+	require.Len(t, store.streams["snapshot-order-1"], 1, "the stream grew past 3 events")
+	assert.Equal(t, "3", store.streams["snapshot-order-1"][0].Metadata.Get(eventsourcing.SnapshotRevisionKey))
+
+	addItems(t, repository, order, 1)
+
+	store.reads = nil
+	loaded, err := repository.Load(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, "1", loaded.ID)
+	assert.Equal(t, []string{"item-0", "item-1", "item-2", "item-3"}, loaded.Items)
+	assert.Equal(t, esdb.Revision(4), loaded.Revision())
+
+	require.Len(t, store.reads, 2)
+	assert.Equal(t, esdb.Revision(4), store.reads[1].From, "events after the snapshot are read")
+}
+
+func TestRepositoryLoadsSnapshotWithoutNewerEvents(t *testing.T) {
+	store := &memoryStore{}
+	repository := newTestRepository(store).WithSnapshots(eventsourcing.NewStreamSnapshotStore(store), eventsourcing.EveryNEvents(2))
+
+	order := &Order{}
+	require.NoError(t, eventsourcing.Raise(order, OrderPlaced{ID: "1"}))
+	addItems(t, repository, order, 1)
+
+	loaded, err := repository.Load(context.Background(), "1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"item-0"}, loaded.Items)
+	assert.Equal(t, esdb.Revision(1), loaded.Revision())
+}
+
+func TestRepositoryIgnoresInvalidSnapshot(t *testing.T) {
+	store := &memoryStore{}
+	snapshots := eventsourcing.NewStreamSnapshotStore(store)
+	repository := newTestRepository(store).WithSnapshots(snapshots, eventsourcing.EveryNEvents(100))
+
+	order := &Order{}
+	require.NoError(t, eventsourcing.Raise(order, OrderPlaced{ID: "1"}))
+	addItems(t, repository, order, 1)
+	require.NoError(t, snapshots.SaveSnapshot(context.Background(), "order-1", eventsourcing.Snapshot{Revision: 1, Data: []byte(`{"Items": "not a list"}`)}))
+
+	loaded, err := repository.Load(context.Background(), "1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"item-0"}, loaded.Items)
+}
+
+func TestStreamSnapshotStore(t *testing.T) {
+	store := &memoryStore{}
+	snapshots := eventsourcing.NewStreamSnapshotStore(store)
+	ctx := context.Background()
+
+	snapshot, err := snapshots.LoadSnapshot(ctx, "order-1")
+	require.NoError(t, err)
+	assert.Nil(t, snapshot)
+
+	require.NoError(t, snapshots.SaveSnapshot(ctx, "order-1", eventsourcing.Snapshot{Revision: 9, Data: []byte(`{"ID":"1"}`)}))
+	require.NoError(t, snapshots.SaveSnapshot(ctx, "order-1", eventsourcing.Snapshot{Revision: 19, Data: []byte(`{"ID":"2"}`)}))
+
+	snapshot, err = snapshots.LoadSnapshot(ctx, "order-1")
+	require.NoError(t, err)
+	assert.Equal(t, &eventsourcing.Snapshot{Revision: 19, Data: []byte(`{"ID":"2"}`)}, snapshot)
+
+	metadata := store.metadata["snapshot-order-1"]
+	maxCount := metadata.MaxCount()
+	require.NotNil(t, maxCount)
+	assert.Equal(t, uint64(1), *maxCount)
+}
+
+func TestStreamSnapshotStoreRetriesMaxCount(t *testing.T) {
+	store := &memoryStore{metadataErr: errors.New("access denied")}
+	snapshots := eventsourcing.NewStreamSnapshotStore(store)
+	ctx := context.Background()
+
+	err := snapshots.SaveSnapshot(ctx, "order-1", eventsourcing.Snapshot{Revision: 9, Data: []byte(`{}`)})
+	assert.ErrorContains(t, err, "access denied")
+
+	store.metadataErr = nil
+	require.NoError(t, snapshots.SaveSnapshot(ctx, "order-1", eventsourcing.Snapshot{Revision: 19, Data: []byte(`{}`)}))
+
+	metadata := store.metadata["snapshot-order-1"]
+	maxCount := metadata.MaxCount()
+	require.NotNil(t, maxCount, "$maxCount is set with a later snapshot")
+	assert.Equal(t, uint64(1), *maxCount)
+
+	require.NoError(t, snapshots.SaveSnapshot(ctx, "order-1", eventsourcing.Snapshot{Revision: 29, Data: []byte(`{}`)}))
+	assert.Equal(t, 2, store.metadataSets, "$maxCount is set once it succeeded")
+}
+
+func TestStreamSnapshotStoreKeepsMaxCount(t *testing.T) {
+	metadata := esdb.StreamMetadata{}
+	metadata.SetMaxCount(1)
+	metadata.SetMaxAge(time.Hour)
+	store := &memoryStore{metadata: map[string]esdb.StreamMetadata{"snapshot-order-1": metadata}}
+
+	// Another process, or this one before a restart, already limited the stream.
+	snapshots := eventsourcing.NewStreamSnapshotStore(store)
+	require.NoError(t, snapshots.SaveSnapshot(context.Background(), "order-1", eventsourcing.Snapshot{Revision: 9, Data: []byte(`{}`)}))
+	assert.Zero(t, store.metadataSets)
+}
+
+type failingSnapshotStore struct{}
+
+func (failingSnapshotStore) LoadSnapshot(context.Context, string) (*eventsourcing.Snapshot, error) {
+	return nil, nil
+}
+
+func (failingSnapshotStore) SaveSnapshot(context.Context, string, eventsourcing.Snapshot) error {
+	return errors.New("unavailable")
+}
+
+func TestRepositorySnapshotFailed(t *testing.T) {
+	store := &memoryStore{}
+	repository := newTestRepository(store).WithSnapshots(failingSnapshotStore{}, eventsourcing.EveryNEvents(1))
+
+	order := &Order{}
+	require.NoError(t, eventsourcing.Raise(order, OrderPlaced{ID: "1"}))
+	err := repository.Save(context.Background(), "1", order)
+	assert.ErrorIs(t, err, eventsourcing.ErrSnapshotFailed)
+
+	assert.Len(t, store.streams["order-1"], 1, "events are saved anyway")
+	assert.Empty(t, order.PendingEvents())
+}
+
+type CustomerRegistered struct {
+	ID    string `json:"id"`
+	Email string `json:"email"`
+}
+
+// Customer has personal data, so its events and snapshots are encrypted with the keys of the customer.
+type Customer struct {
+	eventsourcing.Root
+
+	ID    string
+	Email string
+}
+
+func (c *Customer) Apply(event any) error {
+	registered, ok := event.(CustomerRegistered)
+	if !ok {
+		return fmt.Errorf("unknown event %T", event)
+	}
+
+	c.ID = registered.ID
+	c.Email = registered.Email
+	return nil
+}
+
+func (c *Customer) EventMetadata() message.Metadata {
+	return message.Metadata{wesdb.DefaultEncryptionSubjectKey: c.ID}
+}
+
+func TestAggregateMetadata(t *testing.T) {
+	store := &memoryStore{}
+	events := wesdb.NewEventRegistry()
+	events.MustRegister("CustomerRegistered", 1, CustomerRegistered{})
+	repository := eventsourcing.NewRepository(store, events, "customer", func() *Customer {
+		return &Customer{}
+	}).WithSnapshots(eventsourcing.NewStreamSnapshotStore(store), eventsourcing.EveryNEvents(1))
+
+	customer := &Customer{}
+	require.NoError(t, eventsourcing.Raise(customer, CustomerRegistered{ID: "42", Email: "jane@example.com"}))
+	require.NoError(t, repository.Save(context.Background(), "42", customer))
+
+	require.Len(t, store.streams["customer-42"], 1)
+	assert.Equal(t, "42", store.streams["customer-42"][0].Metadata.Get(wesdb.DefaultEncryptionSubjectKey))
+
+	require.Len(t, store.streams["snapshot-customer-42"], 1)
+	assert.Equal(t, "42", store.streams["snapshot-customer-42"][0].Metadata.Get(wesdb.DefaultEncryptionSubjectKey))
+	assert.Equal(t, "0", store.streams["snapshot-customer-42"][0].Metadata.Get(eventsourcing.SnapshotRevisionKey))
+}